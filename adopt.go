@@ -0,0 +1,439 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// adoptOutcome is what `myrientor adopt` did with one existing file.
+type adoptOutcome int
+
+const (
+	adoptAdopted   adoptOutcome = iota // moved or linked into the layout
+	adoptPresent                       // already at its layout path, or an identical copy is
+	adoptMismatch                      // a remote file has this name but size or checks differ
+	adoptConflict                      // a different file already occupies the layout path
+	adoptUnmatched                     // no remote file with this name
+	adoptFailed                        // checking, moving or linking failed
+	adoptCount
+)
+
+var adoptLabels = [adoptCount]struct {
+	symbol, name string
+}{
+	adoptAdopted:   {"+", "Adopted"},
+	adoptPresent:   {"=", "Already present"},
+	adoptMismatch:  {"~", "Mismatch"},
+	adoptConflict:  {"!", "Conflict"},
+	adoptUnmatched: {"?", "Unmatched"},
+	adoptFailed:    {"✗", "Failed"},
+}
+
+// color returns the color an outcome is shown in, looked up when printing
+// so that plain output has none.
+func (o adoptOutcome) color() string {
+	switch o {
+	case adoptAdopted:
+		return colorGreen
+	case adoptMismatch:
+		return colorYellow
+	case adoptConflict, adoptFailed:
+		return colorRed
+	}
+	return colorDim
+}
+
+// adoptResult is the outcome for one source file.
+type adoptResult struct {
+	Source  string
+	Target  string
+	Size    int64
+	Outcome adoptOutcome
+	Detail  string
+}
+
+// runAdoptCommand implements `myrientor adopt <dir> -device <name>`: files
+// already on disk are matched against the device's remote listing and moved
+// or hardlinked to where a sync would put them, so they are not downloaded
+// again.
+func runAdoptCommand(args []string) int {
+	fs := flag.NewFlagSet("adopt", flag.ExitOnError)
+	flags := registerFlags(fs)
+	devicePattern := fs.String("device", "", "Device to adopt into (local_path, remote_path or glob matching exactly one device)")
+	link := fs.Bool("link", false, "Hardlink files into the layout instead of moving them")
+	check := fs.Bool("verify", false, "Check zip CRCs and hash sidecars before adopting")
+	datPath := fs.String("dat", "", "Logiqx XML DAT file to check ROM sizes and CRCs against (implies -verify)")
+	dryRun := fs.Bool("dry-run", false, "Report what would be adopted without changing anything")
+	fs.Parse(args)
+	// Accept flags after the directory too: adopt ~/roms -device gb
+	var dir string
+	if fs.NArg() > 0 {
+		dir = fs.Arg(0)
+		fs.Parse(fs.Args()[1:])
+	}
+	if dir == "" || *devicePattern == "" || fs.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "%s✗ Usage: myrientor adopt <dir> -device <name> [-link] [-verify] [-dat file] [-dry-run]%s\n", colorRed, colorReset)
+		return exitConfig
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		fmt.Fprintf(os.Stderr, "%s✗ %s is not a directory%s\n", colorRed, dir, colorReset)
+		return exitConfig
+	}
+
+	cfg, err := loadConfig(flags)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s✗ Config error: %v%s\n", colorRed, err, colorReset)
+		return exitConfig
+	}
+	state, err := loadSyncState()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s✗ Error reading state file %s: %v%s\n", colorRed, stateFile, err, colorReset)
+		return exitConfig
+	}
+	devices, err := cfg.MatchDevices([]string{*devicePattern})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s✗ %v%s\n", colorRed, err, colorReset)
+		return exitConfig
+	}
+	if len(devices) > 1 {
+		fmt.Fprintf(os.Stderr, "%s✗ %s matches %d devices; be more specific:%s\n", colorRed, *devicePattern, len(devices), colorReset)
+		for _, device := range devices {
+			fmt.Fprintf(os.Stderr, "  %s → %s\n", device.RemotePath, device.LocalPath)
+		}
+		return exitConfig
+	}
+	device := devices[0]
+	settings, err := cfg.DeviceSettings(device)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s✗ Invalid settings: %v%s\n", colorRed, err, colorReset)
+		return exitConfig
+	}
+
+	var dat datIndex
+	if *datPath != "" {
+		if dat, err = loadDAT(*datPath); err != nil {
+			fmt.Fprintf(os.Stderr, "%s✗ Error reading DAT %s: %v%s\n", colorRed, *datPath, err, colorReset)
+			return exitConfig
+		}
+		*check = true
+	}
+
+	fmt.Printf("\n%s\n", devicePanel(1, 1, "Adopting", device.RemotePath))
+
+	client := newQuickClient()
+	statusLine("%s  Scanning...%s", colorDim, colorReset)
+	plan, err := planDevice(client, device, settings, state, nil, func(subDir string) {
+		label := "root"
+		if subDir != "" {
+			label = subDir
+		}
+		statusLine("%s  Scanning: %s%s", colorDim, fitInTerminal(label, 13), colorReset)
+	})
+	clearStatusLine()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s✗ %v%s\n", colorRed, err, colorReset)
+		return exitErrors
+	}
+
+	// Sources are matched concurrently; one writes the progress line at a time.
+	var progressMu sync.Mutex
+	adopter := &adopter{
+		device:  device,
+		plan:    plan,
+		state:   state,
+		client:  client,
+		link:    *link,
+		check:   *check,
+		dat:     dat,
+		dryRun:  *dryRun,
+		byName:  make(map[string][]syncTask),
+		byLower: make(map[string][]syncTask),
+		claimed: make(map[string]string),
+		progress: func(name string) {
+			progressMu.Lock()
+			defer progressMu.Unlock()
+			statusLine("%s  Matching: %s%s", colorDim, fitInTerminal(name, 14), colorReset)
+		},
+	}
+	for _, task := range plan.Tasks {
+		adopter.byName[task.Name] = append(adopter.byName[task.Name], task)
+		lower := strings.ToLower(task.Name)
+		adopter.byLower[lower] = append(adopter.byLower[lower], task)
+	}
+
+	var sources []string
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return nil
+		}
+		if _, isSidecar := sidecarHashes[strings.ToLower(filepath.Ext(path))]; !isSidecar && !strings.HasSuffix(path, partSuffix) {
+			sources = append(sources, path)
+		}
+		return nil
+	})
+	sort.Strings(sources)
+
+	results := make([]adoptResult, len(sources))
+	sem := make(chan struct{}, settings.MaxConcurrent)
+	var wg sync.WaitGroup
+	for i, source := range sources {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i] = adopter.adopt(source)
+		}()
+	}
+	wg.Wait()
+	clearStatusLine()
+
+	if !*dryRun {
+		if err := state.Save(); err != nil {
+			fmt.Fprintf(os.Stderr, "%s✗ Error saving %s: %v%s\n", colorRed, stateFile, err, colorReset)
+			return exitErrors
+		}
+	}
+
+	return printAdoptResults(results, *dryRun)
+}
+
+// adopter matches source files against one device's plan. It is safe for
+// concurrent use.
+type adopter struct {
+	device   Device
+	plan     *devicePlan
+	state    *SyncState
+	client   *http.Client
+	link     bool
+	check    bool
+	dat      datIndex
+	dryRun   bool
+	byName   map[string][]syncTask // remote file name → tasks
+	byLower  map[string][]syncTask // lower-cased name → tasks, for case-insensitive filesystems
+	progress func(name string)
+
+	mu      sync.Mutex
+	claimed map[string]string // target path → source adopted into it this run
+}
+
+// adopt matches one source file and, if it belongs to the device, moves or
+// links it to its layout path and records it in the sync state.
+func (a *adopter) adopt(source string) adoptResult {
+	result := adoptResult{Source: source}
+	info, err := os.Stat(source)
+	if err != nil {
+		result.Outcome, result.Detail = adoptFailed, err.Error()
+		return result
+	}
+	result.Size = info.Size()
+	a.progress(info.Name())
+
+	candidates := a.byName[info.Name()]
+	if len(candidates) == 0 {
+		candidates = a.byLower[strings.ToLower(info.Name())]
+	}
+	if len(candidates) == 0 {
+		result.Outcome = adoptUnmatched
+		return result
+	}
+
+	// Listed sizes are rounded, so the exact size comes from a HEAD request.
+	// A candidate that cannot be checked does not stop the others from
+	// matching; it only fails the file if none of them does.
+	var task syncTask
+	var remote FileState
+	var modTime time.Time
+	var headErr error
+	found := false
+	for _, candidate := range candidates {
+		url := remoteFileURL(a.plan.RemoteURL, candidate.FileInfo)
+		size, mtime, err := headFile(a.client, url)
+		if err != nil {
+			headErr = err
+			continue
+		}
+		if size == info.Size() {
+			task, modTime, found = candidate, mtime, true
+			remote = FileState{Remote: candidate.RelPath(), Size: size}
+			break
+		}
+		result.Detail = fmt.Sprintf("size %s, remote %s", formatBytes(info.Size()), formatBytes(size))
+	}
+	if !found && headErr != nil {
+		result.Outcome, result.Detail = adoptFailed, headErr.Error()
+		return result
+	}
+	if !found {
+		result.Outcome = adoptMismatch
+		return result
+	}
+	result.Target = task.LocalPath
+
+	if a.check {
+		if status, detail := verifyFile(source, &remote, a.dat); status != verifyOK {
+			result.Outcome, result.Detail = adoptMismatch, detail
+			return result
+		}
+	}
+
+	if owner, ok := a.state.Owner(task.LocalPath); ok && owner != deviceKey(a.device) {
+		result.Outcome, result.Detail = adoptConflict, "owned by "+owner
+		return result
+	}
+
+	// Two sources may match the same remote file; the first one wins.
+	a.mu.Lock()
+	if other, ok := a.claimed[task.LocalPath]; ok {
+		a.mu.Unlock()
+		result.Outcome, result.Detail = adoptPresent, "duplicate of "+other
+		return result
+	}
+	a.claimed[task.LocalPath] = source
+	a.mu.Unlock()
+
+	if sameFile(source, task.LocalPath) {
+		result.Outcome = adoptPresent
+		if !a.dryRun {
+			a.state.RecordFile(a.device, task.LocalPath, remote)
+		}
+		return result
+	}
+	if existing, err := os.Stat(task.LocalPath); err == nil {
+		if existing.Size() != remote.Size {
+			result.Outcome, result.Detail = adoptConflict, fmt.Sprintf("%s already exists", task.LocalPath)
+			return result
+		}
+		result.Outcome, result.Detail = adoptPresent, task.LocalPath+" already exists"
+		if !a.dryRun {
+			a.state.RecordFile(a.device, task.LocalPath, remote)
+		}
+		return result
+	}
+
+	result.Outcome = adoptAdopted
+	if a.dryRun {
+		return result
+	}
+	if err := os.MkdirAll(filepath.Dir(task.LocalPath), 0755); err != nil {
+		result.Outcome, result.Detail = adoptFailed, err.Error()
+		return result
+	}
+	if a.link {
+		err = os.Link(source, task.LocalPath)
+	} else {
+		err = moveFile(source, task.LocalPath)
+	}
+	if err != nil {
+		result.Outcome, result.Detail = adoptFailed, err.Error()
+		return result
+	}
+	// Match the remote timestamp so the next sync sees the file as current.
+	if !modTime.IsZero() {
+		os.Chtimes(task.LocalPath, modTime, modTime)
+	}
+	a.state.RecordFile(a.device, task.LocalPath, remote)
+	return result
+}
+
+// sameFile reports whether both paths name the same existing file.
+func sameFile(a, b string) bool {
+	infoA, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	infoB, err := os.Stat(b)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(infoA, infoB)
+}
+
+// moveFile renames src to dst, copying and removing src when they are on
+// different filesystems.
+func moveFile(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(dst)
+		return err
+	}
+	in.Close()
+	return os.Remove(src)
+}
+
+// printAdoptResults lists every file that was not adopted and prints the
+// totals. It returns the exit code: 1 if anything failed.
+func printAdoptResults(results []adoptResult, dryRun bool) int {
+	var counts [adoptCount]int
+	var adoptedBytes int64
+	for _, r := range results {
+		counts[r.Outcome]++
+		if r.Outcome == adoptAdopted {
+			adoptedBytes += r.Size
+		}
+	}
+
+	for _, outcome := range []adoptOutcome{adoptMismatch, adoptConflict, adoptFailed, adoptUnmatched} {
+		if counts[outcome] == 0 {
+			continue
+		}
+		label := adoptLabels[outcome]
+		fmt.Printf("\n  %s%s %s (%d)%s\n", outcome.color(), label.symbol, label.name, counts[outcome], colorReset)
+		for _, r := range results {
+			if r.Outcome != outcome {
+				continue
+			}
+			line := "    " + r.Source
+			if r.Detail != "" {
+				line += " " + colorDim + "(" + r.Detail + ")" + colorReset
+			}
+			fmt.Println(line)
+		}
+	}
+
+	adopted := "adopted"
+	if dryRun {
+		adopted = "to adopt"
+	}
+	fmt.Println()
+	fmt.Println(panelTopLabeled("ADOPT"))
+	fmt.Println(panelLine(fmt.Sprintf("%sFiles:%s    %s%d %s%s  %d present  %s%d mismatch%s  %s%d conflict%s  %d unmatched",
+		colorBold, colorReset,
+		colorGreen, counts[adoptAdopted], adopted, colorReset,
+		counts[adoptPresent],
+		colorYellow, counts[adoptMismatch], colorReset,
+		colorRed, counts[adoptConflict]+counts[adoptFailed], colorReset,
+		counts[adoptUnmatched])))
+	fmt.Println(panelLine(fmt.Sprintf("%sSize:%s     %s%s %s%s",
+		colorBold, colorReset, colorCyan, formatBytes(adoptedBytes), adopted, colorReset)))
+	fmt.Println(panelBottom())
+
+	if counts[adoptFailed] > 0 {
+		return exitErrors
+	}
+	return exitOK
+}
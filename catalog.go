@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	catalogFile   = "myrientor-catalog.json"
+	catalogMaxAge = 7 * 24 * time.Hour // older catalogs still work but print a refresh hint
+)
+
+// catalogEntry is one remote file of a device listed in remote.json.
+type catalogEntry struct {
+	RemotePath string `json:"remote_path"` // device remote path
+	File       string `json:"file"`        // path relative to RemotePath, / separated
+	Size       int64  `json:"size"`
+}
+
+// catalog is the cached remote listing of every device in remote.json,
+// used by `search` and `get` without crawling the mirror each time.
+type catalog struct {
+	BaseURL string         `json:"base_url"`
+	Updated time.Time      `json:"updated"`
+	Entries []catalogEntry `json:"entries"`
+}
+
+// loadCatalog reads the cached catalog. It returns nil without error if
+// there is none yet.
+func loadCatalog() (*catalog, error) {
+	data, err := os.ReadFile(catalogFile)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var c catalog
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("%s: %w", catalogFile, err)
+	}
+	return &c, nil
+}
+
+// Save writes the catalog atomically.
+func (c *catalog) Save() error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	tmp := catalogFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, catalogFile)
+}
+
+// buildCatalog crawls the remote listing of every distinct remote path in
+// remote.json, maxConcurrent at a time. Devices whose listing fails are
+// reported through onError and left out. onDevice is called as each device
+// finishes.
+func buildCatalog(baseURL string, devices []Device, maxConcurrent int, onDevice func(done, total int, remotePath string), onError func(remotePath string, err error)) *catalog {
+	seen := make(map[string]bool)
+	var remotePaths []string
+	for _, device := range devices {
+		if !seen[device.RemotePath] {
+			seen[device.RemotePath] = true
+			remotePaths = append(remotePaths, device.RemotePath)
+		}
+	}
+
+	client := newQuickClient()
+	c := &catalog{BaseURL: baseURL, Updated: time.Now()}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, maxConcurrent)
+	done := 0
+	for _, remotePath := range remotePaths {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			files, err := getDirectoryListing(client, baseURL+remotePath, nil)
+
+			mu.Lock()
+			defer mu.Unlock()
+			done++
+			if err != nil {
+				onError(remotePath, err)
+			}
+			for _, file := range files {
+				c.Entries = append(c.Entries, catalogEntry{RemotePath: remotePath, File: file.RelPath(), Size: file.Size})
+			}
+			onDevice(done, len(remotePaths), remotePath)
+		}()
+	}
+	wg.Wait()
+
+	sort.Slice(c.Entries, func(i, j int) bool {
+		if c.Entries[i].RemotePath != c.Entries[j].RemotePath {
+			return c.Entries[i].RemotePath < c.Entries[j].RemotePath
+		}
+		return c.Entries[i].File < c.Entries[j].File
+	})
+	return c
+}
+
+// fileInfo converts the entry to the FileInfo its device's layout expects.
+func (e catalogEntry) fileInfo() FileInfo {
+	return fileInfoFromRelPath(e.File, e.Size)
+}
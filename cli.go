@@ -0,0 +1,179 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const envPrefix = "MYRIENTOR_"
+
+// cliFlags holds the command-line flags shared by sync and the subcommands
+// that need the effective configuration.
+type cliFlags struct {
+	concurrent   *int
+	sync         *string
+	profile      *string
+	baseURL      *string
+	maxSpeed     *string
+	stallTimeout *int
+	deletePolicy *string
+	layout       *string
+	minFreeSpace *string
+	logRetention *int
+	logLevel     *string
+	logFormat    *string
+	logDir       *string
+	logMaxSize   *string
+	logAudit     *optionalBool
+}
+
+// registerFlags defines the configuration flags on fs. Each usage string
+// names the environment variable that can set the same value.
+func registerFlags(fs *flag.FlagSet) *cliFlags {
+	return &cliFlags{
+		concurrent:   fs.Int("concurrent", 0, "Maximum concurrent downloads (env "+envPrefix+"MAX_CONCURRENT)"),
+		sync:         fs.String("sync", "", "Sync device(s) matching local_path or remote_path (env "+envPrefix+"SYNC)"),
+		profile:      fs.String("profile", "", "Sync using a named profile from local.json (env "+envPrefix+"PROFILE)"),
+		baseURL:      fs.String("base-url", "", "Mirror to download from, ending with / (env "+envPrefix+"BASE_URL)"),
+		maxSpeed:     fs.String("max-speed", "", "Bandwidth cap per device, e.g. \"5 MiB\" (env "+envPrefix+"MAX_SPEED)"),
+		stallTimeout: fs.Int("stall-timeout", 0, "Seconds without data before a download is retried (env "+envPrefix+"STALL_TIMEOUT)"),
+		deletePolicy: fs.String("delete-policy", "", "Obsolete local files: \"delete\" or \"keep\" (env "+envPrefix+"DELETE_POLICY)"),
+		layout:       fs.String("layout", "", "Local path template (env "+envPrefix+"LAYOUT)"),
+		minFreeSpace: fs.String("min-free-space", "", "Drain when free disk space drops below this, e.g. \"10 GiB\" (env "+envPrefix+"MIN_FREE_SPACE)"),
+		logRetention: fs.Int("log-retention", 0, "Days to keep logs before prune removes them (env "+envPrefix+"LOG_RETENTION)"),
+		logLevel:     fs.String("log-level", "", "Lowest level written to the log: debug, info, warn or error (env "+envPrefix+"LOG_LEVEL)"),
+		logFormat:    fs.String("log-format", "", "Log file format: text or json (env "+envPrefix+"LOG_FORMAT)"),
+		logDir:       fs.String("log-dir", "", "Directory for log files (env "+envPrefix+"LOG_DIR)"),
+		logMaxSize:   fs.String("log-max-size", "", "Rotate the log file past this size, e.g. \"10 MiB\" (env "+envPrefix+"LOG_MAX_SIZE)"),
+		logAudit:     optionalBoolFlag(fs, "log-audit", "Also log successful downloads and deletions (env "+envPrefix+"LOG_AUDIT)"),
+	}
+}
+
+// optionalBool is a boolean flag that remembers whether it was given, so
+// that -log-audit=false can turn off what a lower layer turned on.
+type optionalBool struct {
+	value *bool // nil until the flag is given
+}
+
+func optionalBoolFlag(fs *flag.FlagSet, name, usage string) *optionalBool {
+	b := &optionalBool{}
+	fs.Var(b, name, usage)
+	return b
+}
+
+func (b *optionalBool) String() string {
+	if b == nil || b.value == nil {
+		return ""
+	}
+	return strconv.FormatBool(*b.value)
+}
+
+func (b *optionalBool) Set(s string) error {
+	v, err := strconv.ParseBool(s)
+	if err != nil {
+		return err
+	}
+	b.value = &v
+	return nil
+}
+
+func (b *optionalBool) IsBoolFlag() bool { return true }
+
+// settings returns the settings layer set by flags.
+func (f *cliFlags) settings() Settings {
+	return Settings{
+		MaxConcurrent: *f.concurrent,
+		BaseURL:       *f.baseURL,
+		MaxSpeed:      *f.maxSpeed,
+		StallTimeout:  *f.stallTimeout,
+		DeletePolicy:  *f.deletePolicy,
+		Layout:        *f.layout,
+		MinFreeSpace:  *f.minFreeSpace,
+		LogRetention:  *f.logRetention,
+		LogLevel:      *f.logLevel,
+		LogFormat:     *f.logFormat,
+		LogDir:        *f.logDir,
+		LogMaxSize:    *f.logMaxSize,
+		LogAudit:      f.logAudit.value,
+	}
+}
+
+// settingsFromEnv returns the settings layer set by MYRIENTOR_* variables.
+func settingsFromEnv() (Settings, error) {
+	var s Settings
+	var err error
+	if s.MaxConcurrent, err = envInt("MAX_CONCURRENT"); err != nil {
+		return Settings{}, err
+	}
+	if s.StallTimeout, err = envInt("STALL_TIMEOUT"); err != nil {
+		return Settings{}, err
+	}
+	if s.LogRetention, err = envInt("LOG_RETENTION"); err != nil {
+		return Settings{}, err
+	}
+	s.BaseURL = os.Getenv(envPrefix + "BASE_URL")
+	s.MaxSpeed = os.Getenv(envPrefix + "MAX_SPEED")
+	s.DeletePolicy = os.Getenv(envPrefix + "DELETE_POLICY")
+	s.Layout = os.Getenv(envPrefix + "LAYOUT")
+	s.MinFreeSpace = os.Getenv(envPrefix + "MIN_FREE_SPACE")
+	s.LogLevel = os.Getenv(envPrefix + "LOG_LEVEL")
+	s.LogFormat = os.Getenv(envPrefix + "LOG_FORMAT")
+	s.LogDir = os.Getenv(envPrefix + "LOG_DIR")
+	s.LogMaxSize = os.Getenv(envPrefix + "LOG_MAX_SIZE")
+	if value := os.Getenv(envPrefix + "LOG_AUDIT"); value != "" {
+		audit, err := strconv.ParseBool(value)
+		if err != nil {
+			return Settings{}, fmt.Errorf("%sLOG_AUDIT: %q is not a boolean", envPrefix, value)
+		}
+		s.LogAudit = &audit
+	}
+	return s, nil
+}
+
+func envInt(name string) (int, error) {
+	value := os.Getenv(envPrefix + name)
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("%s%s: %q is not a number", envPrefix, name, value)
+	}
+	return n, nil
+}
+
+// flagOrEnv returns the flag value if set, else the environment variable,
+// along with the name of the layer it came from.
+func flagOrEnv(flagValue, envName string) (value, source string) {
+	if flagValue != "" {
+		return flagValue, "flag"
+	}
+	if value := os.Getenv(envPrefix + envName); value != "" {
+		return value, "env " + envPrefix + envName
+	}
+	return "", "default"
+}
+
+// usage prints help for the main command, including subcommands and the
+// order in which settings are applied.
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage:\n")
+	fmt.Fprintf(out, "  myrientor [flags]          Sync enabled devices\n")
+	fmt.Fprintf(out, "  myrientor config show      Print the effective configuration and where each value came from\n")
+	fmt.Fprintf(out, "  myrientor select           Pick devices and edit local paths interactively\n")
+	fmt.Fprintf(out, "  myrientor list             List devices with local file counts and last sync\n")
+	fmt.Fprintf(out, "  myrientor status [device…] Compare local files against the remote without changing anything\n")
+	fmt.Fprintf(out, "  myrientor verify [device…] Check local files offline (zip CRCs, sizes, hash sidecars, DAT)\n")
+	fmt.Fprintf(out, "  myrientor search <query>   Search every device's files in the cached catalog\n")
+	fmt.Fprintf(out, "  myrientor get <result|path>… Download single files into their device's local path\n")
+	fmt.Fprintf(out, "  myrientor adopt <dir> -device <name> Move existing files into the layout instead of downloading them\n")
+	fmt.Fprintf(out, "  myrientor prune [device…]  Remove empty directories, stale partial downloads and old logs\n")
+	fmt.Fprintf(out, "\nFlags:\n")
+	flag.PrintDefaults()
+	fmt.Fprintf(out, "\nSettings priority (highest first):\n")
+	fmt.Fprintf(out, "  %s\n", strings.Join([]string{"flag", "env " + envPrefix + "*", "device (remote.json)", "profile", "local.json", "default"}, " > "))
+}
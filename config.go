@@ -1,8 +1,14 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
 	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
 )
 
 const (
@@ -11,7 +17,18 @@ const (
 )
 
 type LocalConfig struct {
-	MaxConcurrent int `json:"max_concurrent"`
+	Settings
+	Profiles map[string]Profile `json:"profiles"`
+}
+
+// Profile is a named target library: which devices to sync, where to put
+// them, and how.
+type Profile struct {
+	Settings
+	Devices   []string `json:"devices"`    // local_path, remote_path, or glob; empty selects all enabled devices
+	LocalRoot string   `json:"local_root"` // prepended to each device's local_path
+	Include   []string `json:"include"`    // filename globs to download; empty means all
+	Exclude   []string `json:"exclude"`    // filename globs to never download
 }
 
 type RemoteConfig struct {
@@ -23,6 +40,7 @@ type Device struct {
 	RemotePath string `json:"remote_path"`
 	Sync       bool   `json:"sync"`
 	LocalPath  string `json:"local_path"`
+	Settings          // optional per-device overrides
 }
 
 func readLocalConfigFile() (*LocalConfig, error) {
@@ -57,6 +75,46 @@ func readRemoteConfigFile() (*RemoteConfig, error) {
 	return &config, nil
 }
 
+// FindProfile returns the named profile from the local config.
+func (l *LocalConfig) FindProfile(name string) (Profile, bool) {
+	if l == nil {
+		return Profile{}, false
+	}
+	profile, ok := l.Profiles[name]
+	return profile, ok
+}
+
+// ProfileNames returns the names of all configured profiles, sorted.
+func (l *LocalConfig) ProfileNames() []string {
+	if l == nil {
+		return nil
+	}
+	names := make([]string, 0, len(l.Profiles))
+	for name := range l.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// writeRemoteConfigFile saves config back to remote.json, keeping the
+// file's tab indentation and leaving characters such as & unescaped.
+func writeRemoteConfigFile(config *RemoteConfig) error {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "\t")
+	if err := encoder.Encode(config); err != nil {
+		return err
+	}
+
+	tmp := remoteConfigFile + ".tmp"
+	if err := os.WriteFile(tmp, bytes.TrimSuffix(buf.Bytes(), []byte("\n")), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, remoteConfigFile)
+}
+
 func (d *Device) ShouldSync() bool {
 	return d != nil &&
 		d.Sync &&
@@ -92,3 +150,224 @@ func (r *RemoteConfig) FindAllByPath(path string) []Device {
 	}
 	return matches
 }
+
+// FindAllByProfile returns the devices selected by a profile. Devices listed
+// explicitly are selected even if their sync flag is off, so one remote.json
+// can serve several libraries. An empty list selects all enabled devices.
+func (r *RemoteConfig) FindAllByProfile(profile Profile) []Device {
+	if r == nil {
+		return nil
+	}
+	var matches []Device
+	for _, device := range r.Devices {
+		if device.LocalPath == "" {
+			continue
+		}
+		if len(profile.Devices) == 0 {
+			if device.ShouldSync() {
+				matches = append(matches, device)
+			}
+			continue
+		}
+		for _, pattern := range profile.Devices {
+			if device.matches(pattern) {
+				matches = append(matches, device)
+				break
+			}
+		}
+	}
+	return matches
+}
+
+// matches reports whether pattern equals the device's LocalPath or
+// RemotePath, or matches either of them as a glob.
+func (d *Device) matches(pattern string) bool {
+	if d.LocalPath == pattern || d.RemotePath == pattern {
+		return true
+	}
+	if ok, _ := path.Match(pattern, d.LocalPath); ok {
+		return true
+	}
+	ok, _ := path.Match(strings.TrimSuffix(pattern, "/"), strings.TrimSuffix(d.RemotePath, "/"))
+	return ok
+}
+
+// settingsLayer is one named source of settings.
+type settingsLayer struct {
+	Source   string
+	Settings Settings
+}
+
+// Config is the fully loaded configuration for a run: both config files,
+// the selected profile, and every settings layer in precedence order.
+type Config struct {
+	Local         *LocalConfig
+	Remote        *RemoteConfig
+	ProfileName   string
+	ProfileSource string
+	Profile       Profile
+	SyncPath      string
+	SyncSource    string
+	Filter        FileFilter
+	lower         []settingsLayer // layers below the device layer
+	upper         []settingsLayer // layers above the device layer
+}
+
+// loadConfig reads remote.json and local.json and applies the profile,
+// environment and flag layers. A missing or unreadable local.json is only an
+// error when a profile is requested.
+func loadConfig(flags *cliFlags) (*Config, error) {
+	remoteConfig, err := readRemoteConfigFile()
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", remoteConfigFile, err)
+	}
+
+	localConfig, localErr := readLocalConfigFile()
+	if localErr != nil {
+		localConfig = &LocalConfig{}
+	}
+
+	envSettings, err := settingsFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &Config{
+		Local:  localConfig,
+		Remote: remoteConfig,
+	}
+	cfg.ProfileName, cfg.ProfileSource = flagOrEnv(*flags.profile, "PROFILE")
+	cfg.SyncPath, cfg.SyncSource = flagOrEnv(*flags.sync, "SYNC")
+
+	// Resolve the selected profile, if any
+	if cfg.ProfileName != "" {
+		if localErr != nil {
+			return nil, fmt.Errorf("error reading %s: %w", localConfigFile, localErr)
+		}
+		profile, ok := localConfig.FindProfile(cfg.ProfileName)
+		if !ok {
+			return nil, fmt.Errorf("no profile named %q (available: %s)", cfg.ProfileName, strings.Join(localConfig.ProfileNames(), ", "))
+		}
+		cfg.Profile = profile
+	}
+
+	cfg.Filter = FileFilter{Include: cfg.Profile.Include, Exclude: cfg.Profile.Exclude}
+	if err := cfg.Filter.Validate(); err != nil {
+		return nil, fmt.Errorf("profile %s: %w", cfg.ProfileName, err)
+	}
+
+	cfg.lower = []settingsLayer{
+		{"default", defaultSettings},
+		{remoteConfigFile, Settings{BaseURL: remoteConfig.BaseURL}},
+		{localConfigFile, localConfig.Settings},
+		{"profile " + cfg.ProfileName, cfg.Profile.Settings},
+	}
+	cfg.upper = []settingsLayer{
+		{"env", envSettings},
+		{"flag", flags.settings()},
+	}
+	return cfg, nil
+}
+
+// Layers returns every settings layer from lowest to highest precedence.
+// If device is non-nil its overrides are included.
+func (c *Config) Layers(device *Device) []settingsLayer {
+	layers := append([]settingsLayer{}, c.lower...)
+	if device != nil {
+		layers = append(layers, settingsLayer{"device " + device.RemotePath, device.Settings})
+	}
+	return append(layers, c.upper...)
+}
+
+// Settings returns the merged settings that apply to every device.
+func (c *Config) Settings() Settings {
+	var merged Settings
+	for _, layer := range c.Layers(nil) {
+		merged = merged.Merge(layer.Settings)
+	}
+	return merged
+}
+
+// DeviceSettings resolves the effective settings for one device.
+func (c *Config) DeviceSettings(device Device) (SyncSettings, error) {
+	var merged Settings
+	for _, layer := range c.Layers(&device) {
+		merged = merged.Merge(layer.Settings)
+	}
+	return merged.Resolve(c.Filter)
+}
+
+// SelectDevices returns the devices to sync: those matching -sync, else those
+// selected by the profile, else all enabled devices. Devices are placed under
+// the profile's local_root.
+func (c *Config) SelectDevices() ([]Device, error) {
+	var devices []Device
+	switch {
+	case c.SyncPath != "":
+		devices = c.Remote.FindAllByPath(c.SyncPath)
+		if len(devices) == 0 {
+			return nil, fmt.Errorf("no syncable device found matching: %s", c.SyncPath)
+		}
+	case c.ProfileName != "":
+		devices = c.Remote.FindAllByProfile(c.Profile)
+		if len(devices) == 0 {
+			return nil, fmt.Errorf("profile %s selects no devices", c.ProfileName)
+		}
+	default:
+		for _, device := range c.Remote.Devices {
+			if device.ShouldSync() {
+				devices = append(devices, device)
+			}
+		}
+	}
+
+	c.placeUnderRoot(devices)
+	return devices, nil
+}
+
+// MatchDevices returns the devices matching any of patterns (local_path,
+// remote_path or glob), whether or not they are enabled. With no patterns it
+// returns the devices a sync run would select.
+func (c *Config) MatchDevices(patterns []string) ([]Device, error) {
+	if len(patterns) == 0 {
+		return c.SelectDevices()
+	}
+	devices := c.Remote.FindAllByProfile(Profile{Devices: patterns})
+	if len(devices) == 0 {
+		return nil, fmt.Errorf("no device found matching: %s", strings.Join(patterns, ", "))
+	}
+	c.placeUnderRoot(devices)
+	return devices, nil
+}
+
+// FailedDevices returns the devices with failures recorded in log, limited
+// to -sync or the profile's devices when either is set.
+func (c *Config) FailedDevices(log *FailureLog) []Device {
+	candidates := append([]Device(nil), c.Remote.Devices...)
+	if c.SyncPath != "" || c.ProfileName != "" {
+		var err error
+		if candidates, err = c.SelectDevices(); err != nil {
+			return nil
+		}
+	} else {
+		c.placeUnderRoot(candidates)
+	}
+
+	var devices []Device
+	for _, device := range candidates {
+		if len(log.ForDevice(device)) > 0 {
+			devices = append(devices, device)
+		}
+	}
+	return devices
+}
+
+// placeUnderRoot places every device under the profile's destination root.
+func (c *Config) placeUnderRoot(devices []Device) {
+	if c.Profile.LocalRoot == "" {
+		return
+	}
+	for i := range devices {
+		devices[i].LocalPath = filepath.Join(c.Profile.LocalRoot, devices[i].LocalPath)
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// runConfigCommand implements `myrientor config <subcommand>`.
+func runConfigCommand(args []string) int {
+	if len(args) == 0 || args[0] != "show" {
+		fmt.Fprintf(os.Stderr, "Usage: myrientor config show [flags]\n")
+		return exitConfig
+	}
+
+	fs := flag.NewFlagSet("config show", flag.ExitOnError)
+	flags := registerFlags(fs)
+	fs.Parse(args[1:])
+
+	cfg, err := loadConfig(flags)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s✗ Config error: %v%s\n", colorRed, err, colorReset)
+		return exitConfig
+	}
+
+	// For each setting, the highest layer that sets it is where it came from.
+	layers := cfg.Layers(nil)
+	merged := cfg.Settings()
+	fmt.Printf("%s%sEffective configuration%s\n", colorBold, colorCyan, colorReset)
+	for i, field := range merged.Fields() {
+		source := ""
+		for _, layer := range layers {
+			if layer.Settings.Fields()[i].Value != "" {
+				source = layer.Source
+			}
+		}
+		if source == "env" {
+			source = "env " + envPrefix + strings.ToUpper(field.Key)
+		}
+		value := field.Value
+		if value == "" {
+			value = "(unset)"
+		}
+		fmt.Printf("  %-16s %s %s%s%s\n", field.Key, padRunes(value, 44), colorDim, source, colorReset)
+	}
+
+	printSelection := func(key, value, source string) {
+		if value == "" {
+			value = "(none)"
+		}
+		fmt.Printf("  %-16s %s %s%s%s\n", key, padRunes(value, 44), colorDim, source, colorReset)
+	}
+	printSelection("profile", cfg.ProfileName, cfg.ProfileSource)
+	printSelection("sync", cfg.SyncPath, cfg.SyncSource)
+	if cfg.Profile.LocalRoot != "" {
+		printSelection("local_root", cfg.Profile.LocalRoot, "profile "+cfg.ProfileName)
+	}
+
+	// Devices whose own overrides differ from the global settings
+	devices, err := cfg.SelectDevices()
+	if err != nil {
+		fmt.Printf("\n%s✗ %v%s\n", colorRed, err, colorReset)
+		return exitConfig
+	}
+	fmt.Printf("\n%s%d device(s) selected%s\n", colorBold, len(devices), colorReset)
+	for _, device := range devices {
+		for _, field := range device.Settings.Fields() {
+			if field.Value != "" {
+				fmt.Printf("  %s %s = %s\n", padRunes(device.RemotePath, 40), field.Key, field.Value)
+			}
+		}
+	}
+	return exitOK
+}
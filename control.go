@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// Exit codes of a sync run.
+const (
+	exitOK      = 0 // every device synced without errors
+	exitErrors  = 1 // the run completed, but files or devices failed
+	exitConfig  = 2 // invalid flags, settings, config or state files
+	exitDrained = 3 // stopped early by q, a signal or low disk space
+	exitAborted = 4 // stopped by x or a second signal
+)
+
+// runControl is the drain and abort state of a sync run, shared by the
+// hotkeys and the signal handler. Draining stops queuing new files; aborting
+// also cancels the active downloads.
+type runControl struct {
+	drainOnce sync.Once
+	drain     chan struct{}
+	ctx       context.Context
+	abort     context.CancelCauseFunc
+}
+
+func newRunControl() *runControl {
+	ctx, abort := context.WithCancelCause(context.Background())
+	return &runControl{drain: make(chan struct{}), ctx: ctx, abort: abort}
+}
+
+// Drain stops the run from queuing new files.
+func (c *runControl) Drain() {
+	c.drainOnce.Do(func() { close(c.drain) })
+}
+
+// Abort drains the run and cancels its context with errAborted.
+func (c *runControl) Abort() {
+	c.Drain()
+	c.abort(errAborted)
+}
+
+// Draining returns a channel that is closed once the run drains or aborts.
+func (c *runControl) Draining() <-chan struct{} {
+	return c.drain
+}
+
+// Context is cancelled with errAborted when the run aborts.
+func (c *runControl) Context() context.Context {
+	return c.ctx
+}
+
+// Stopped reports whether the run was drained or aborted.
+func (c *runControl) Stopped() bool {
+	select {
+	case <-c.drain:
+		return true
+	default:
+		return false
+	}
+}
+
+// Aborted reports whether the run was aborted.
+func (c *runControl) Aborted() bool {
+	return errors.Is(context.Cause(c.ctx), errAborted)
+}
+
+// HandleSignals makes SIGINT and SIGTERM stop the run gracefully: the first
+// drains it and the second aborts it, like the q and x hotkeys, so the
+// summary is still printed. A third restores the terminal and exits at
+// once. The returned function restores the default signal handling.
+func (c *runControl) HandleSignals() (stop func()) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	done := make(chan struct{})
+	go func() {
+		received := 0
+		for {
+			select {
+			case <-signals:
+			case <-done:
+				return
+			}
+			received++
+			switch received {
+			case 1:
+				c.Drain()
+			case 2:
+				c.Abort()
+			default:
+				restoreTerminal()
+				os.Exit(exitAborted)
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(signals)
+		close(done)
+	}
+}
@@ -0,0 +1,426 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	dashboardRefresh = 100 * time.Millisecond // redraw interval
+	dashboardLogSize = 200                    // recent events kept for the log pane
+)
+
+// dashboardHelp is the key help on the dashboard's last line.
+const dashboardHelp = "q drain  p pause  +/- slots  s n ⏎ skip  x abort  ↑↓ PgUp PgDn queue  ^C stop"
+
+// tui is the running -tui dashboard, or nil.
+var tui *dashboard
+
+// dashboard is the -tui view of the sync: a full-screen page on the
+// terminal's alternate screen with the current device's stats and slots,
+// the queue of pending downloads, a log of recent events and the progress of
+// every device. It redraws the whole screen from the top on every refresh,
+// so a resized terminal never leaves stale lines behind.
+//
+// While it runs, os.Stdout is a pipe: whatever the sync prints goes to the
+// log pane instead of over the dashboard, and is replayed on the normal
+// screen when the dashboard closes. A nil *dashboard does nothing.
+type dashboard struct {
+	mu          sync.Mutex
+	out         *os.File // the terminal
+	devices     []Device
+	plans       []*devicePlan
+	action      string
+	current     int             // index of the device being synced, -1 before the first
+	reports     []*deviceReport // set as devices finish
+	stats       *SyncStats      // the current device's stats once its downloads start
+	log         []string
+	queueOffset int // first queue row shown
+	queueRows   int // queue rows in the last frame, the page size for scrolling
+	width       int // terminal size at the last frame
+	height      int
+
+	captured      bytes.Buffer // everything printed while the dashboard ran
+	pipe          *os.File     // write end of the stdout pipe
+	captureDone   chan struct{}
+	stop          chan struct{}
+	done          chan struct{}
+	removeRestore func()
+}
+
+// startDashboard switches the terminal to the dashboard for syncing
+// devices with their plans. action is "Syncing" or "Retrying".
+func startDashboard(devices []Device, plans []*devicePlan, action string) (*dashboard, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	d := &dashboard{
+		out:         os.Stdout,
+		devices:     devices,
+		plans:       plans,
+		action:      action,
+		current:     -1,
+		reports:     make([]*deviceReport, len(devices)),
+		pipe:        w,
+		captureDone: make(chan struct{}),
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	os.Stdout = w
+	go d.capture(r)
+
+	fmt.Fprint(d.out, "\033[?1049h\033[?25l") // alternate screen, hide cursor
+	d.removeRestore = onTerminalRestore(func() {
+		fmt.Fprint(d.out, "\033[?25h\033[?1049l")
+	})
+	tui = d
+	go d.run()
+	return d, nil
+}
+
+// Close leaves the dashboard and prints what the sync printed meanwhile.
+func (d *dashboard) Close() {
+	if d == nil {
+		return
+	}
+	close(d.stop)
+	<-d.done
+	tui = nil
+	os.Stdout = d.out
+	d.pipe.Close()
+	<-d.captureDone
+	fmt.Fprint(d.out, "\033[?25h\033[?1049l") // show cursor, leave alternate screen
+	d.removeRestore()
+	d.out.Write(d.captured.Bytes())
+}
+
+// DeviceStarted marks device i as the one being synced.
+func (d *dashboard) DeviceStarted(i int) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.current = i
+	d.stats = nil
+	d.queueOffset = 0
+}
+
+// DeviceFinished records the result of device i.
+func (d *dashboard) DeviceFinished(i int, report *deviceReport) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.reports[i] = report
+}
+
+// Scroll moves the queue for a cursor or paging key.
+func (d *dashboard) Scroll(key keyCode) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	switch key {
+	case keyUp:
+		d.queueOffset--
+	case keyDown:
+		d.queueOffset++
+	case keyPageUp:
+		d.queueOffset -= max(d.queueRows, 1)
+	case keyPageDown:
+		d.queueOffset += max(d.queueRows, 1)
+	case keyHome:
+		d.queueOffset = 0
+	case keyEnd:
+		d.queueOffset = len(d.queueLocked())
+	}
+	d.queueOffset = max(d.queueOffset, 0) // the upper bound depends on the frame
+}
+
+// reporter returns the syncReporter that feeds a device's sync into the
+// dashboard.
+func (d *dashboard) reporter() syncReporter {
+	return dashboardReporter{d}
+}
+
+// addLog appends a line to the log pane, dropping the oldest past
+// dashboardLogSize.
+func (d *dashboard) addLog(line string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.log = append(d.log, colorDim+time.Now().Format("15:04:05")+colorReset+" "+line)
+	if len(d.log) > dashboardLogSize {
+		d.log = d.log[len(d.log)-dashboardLogSize:]
+	}
+}
+
+// capture reads what the sync prints, keeps it for Close and adds its
+// messages to the log pane. Panel borders and blank lines are left out.
+func (d *dashboard) capture(r *os.File) {
+	defer close(d.captureDone)
+	defer r.Close()
+	// A Scanner would stop at its token limit and lose everything after one
+	// overlong line, so lines are read whole.
+	reader := bufio.NewReader(io.TeeReader(r, &d.captured))
+	for {
+		text, err := reader.ReadString('\n')
+		if err != nil && text == "" {
+			return
+		}
+		line := strings.TrimSpace(stripANSI(text))
+		if line == "" || strings.ContainsRune("┌└─═", []rune(line)[0]) {
+			continue
+		}
+		line = strings.TrimSpace(strings.Trim(line, "│"))
+		switch {
+		case strings.HasPrefix(line, "✓"):
+			line = colorGreen + line + colorReset
+		case strings.HasPrefix(line, "✗"):
+			line = colorRed + line + colorReset
+		case strings.HasPrefix(line, "⚠"):
+			line = colorYellow + line + colorReset
+		}
+		d.addLog(line)
+	}
+}
+
+// run redraws the dashboard every dashboardRefresh, and at once after a
+// resize, until stop is closed.
+func (d *dashboard) run() {
+	defer close(d.done)
+	resized := watchResize(d.stop)
+	ticker := time.NewTicker(dashboardRefresh)
+	defer ticker.Stop()
+	clear := true
+	for {
+		fmt.Fprint(d.out, d.render(clear))
+		clear = false
+		select {
+		case <-ticker.C:
+		case <-resized:
+			clear = true
+		case <-d.stop:
+			return
+		}
+	}
+}
+
+// render draws the whole screen from the top. Lines are cropped to the
+// terminal width so they never wrap, and the last line has no newline so
+// the screen never scrolls.
+func (d *dashboard) render(clear bool) string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	w, h := terminalWidth(), terminalHeight()
+	var b strings.Builder
+	if clear || w != d.width || h != d.height {
+		b.WriteString("\033[2J")
+	}
+	d.width, d.height = w, h
+
+	b.WriteString("\033[H")
+	lines := d.linesLocked(w, h)
+	for i, line := range lines {
+		line = truncateANSI(line, w)
+		b.WriteString(line)
+		if len([]rune(stripANSI(line))) < w {
+			b.WriteString("\033[K")
+		}
+		if i < len(lines)-1 {
+			b.WriteString("\n")
+		}
+	}
+	b.WriteString("\033[J")
+	return b.String()
+}
+
+// linesLocked lays out the screen, top to bottom: the device panel, the
+// stats panel, the slots, then the devices, queue and log sharing the rest,
+// and the key help. Sections that do not fit are left out. Must be called
+// with d.mu held.
+func (d *dashboard) linesLocked(w, h int) []string {
+	var lines []string
+	if d.current >= 0 {
+		lines = strings.Split(devicePanel(d.current+1, len(d.devices), d.action, d.devices[d.current].RemotePath), "\n")
+	}
+	if d.stats != nil {
+		lines = append(lines, panelTop())
+		for _, row := range d.stats.PanelRows() {
+			lines = append(lines, panelLine(row))
+		}
+		lines = append(lines, panelBottom())
+		lines = append(lines, sectionRule("SLOTS", w))
+		for i, activity := range d.stats.Activities() {
+			if activity == "" {
+				activity = fmt.Sprintf("%s%d · idle%s", colorDim, i+1, colorReset)
+			}
+			lines = append(lines, activity)
+		}
+	}
+
+	// The devices list takes up to a quarter of what is left, the queue
+	// and the log split the rest.
+	rest := h - len(lines) - 1
+	if len(d.devices) > 1 && rest >= 6 {
+		rows := min(len(d.devices), max(rest/4, 1))
+		lines = append(lines, sectionRule(fmt.Sprintf("DEVICES %d", len(d.devices)), w))
+		lines = append(lines, d.deviceRowsLocked(w, rows)...)
+		rest -= rows + 1
+	}
+	queue := d.queueLocked()
+	if len(queue) > 0 && rest >= 4 {
+		section := d.queueRowsLocked(queue, w, (rest-2)/2)
+		lines = append(lines, section...)
+		rest -= len(section)
+	}
+	if rest >= 2 {
+		lines = append(lines, sectionRule("LOG", w))
+		log := d.log[max(len(d.log)-(rest-1), 0):]
+		lines = append(lines, log...)
+		for range rest - 1 - len(log) {
+			lines = append(lines, "")
+		}
+	}
+
+	if len(lines) > h-1 {
+		lines = lines[:max(h-1, 0)]
+	}
+	return append(lines, colorDim+fitInTerminal(dashboardHelp, 1)+colorReset)
+}
+
+// queueLocked returns the current device's pending downloads. Must be
+// called with d.mu held.
+func (d *dashboard) queueLocked() []queuedFile {
+	if d.stats == nil {
+		return nil
+	}
+	return d.stats.Queue()
+}
+
+// queueRowsLocked renders the queue section: its heading and rows from
+// queueOffset, which it keeps within the queue. Must be called with d.mu
+// held.
+func (d *dashboard) queueRowsLocked(queue []queuedFile, w, rows int) []string {
+	d.queueRows = rows
+	d.queueOffset = min(d.queueOffset, max(len(queue)-rows, 0))
+
+	var size int64
+	for _, file := range queue {
+		size += file.Bytes
+	}
+	title := fmt.Sprintf("QUEUE %d file(s), %s", len(queue), formatBytes(size))
+	if len(queue) > rows {
+		title += fmt.Sprintf("  %d-%d", d.queueOffset+1, min(d.queueOffset+rows, len(queue)))
+	}
+
+	lines := []string{sectionRule(title, w)}
+	for _, file := range queue[d.queueOffset:min(d.queueOffset+rows, len(queue))] {
+		lines = append(lines, activityLine("  ", 2, file.Name, " "+formatBytes(file.Bytes)))
+	}
+	return lines
+}
+
+// deviceRowsLocked renders rows lines of the devices list, scrolled to keep
+// the current device in view: name, progress bar, bytes and status. Must be
+// called with d.mu held.
+func (d *dashboard) deviceRowsLocked(w, rows int) []string {
+	first := min(max(d.current-rows/2, 0), len(d.devices)-rows)
+	nameCols := int(float64(w) * barNameShare)
+	var lines []string
+	for i := first; i < first+rows; i++ {
+		var done, total int64
+		if d.plans[i] != nil {
+			total = d.plans[i].DownloadSize
+		}
+		status, color := "pending", colorDim
+		switch {
+		case d.reports[i] != nil:
+			status, color = d.reports[i].Status, statusColor(d.reports[i].Status)
+			done = d.reports[i].Summary.BytesDownloaded
+			if d.reports[i].Status == deviceStatusOK {
+				total = done // listed sizes are approximate
+			}
+			total = max(total, done)
+		case i == d.current:
+			status, color = "syncing", colorCyan
+			if d.stats != nil {
+				progress := d.stats.Progress()
+				done, total = progress.Bytes, progress.TotalBytes
+			}
+		}
+		frac := 0.0
+		switch {
+		case total > 0:
+			frac = min(float64(done)/float64(total), 1)
+		case d.reports[i] != nil:
+			frac = 1
+		}
+
+		marker := "  "
+		if i == d.current {
+			marker = colorMagenta + "▶ " + colorReset
+		}
+		suffix := fmt.Sprintf(" %3.0f%%  %10s / %-10s  %s%s%s", frac*100, formatBytes(done), formatBytes(total), color, status, colorReset)
+		name := strings.TrimSuffix(d.devices[i].RemotePath, "/")
+		suffixCols := len([]rune(stripANSI(suffix)))
+		barCols := w - 2 - nameCols - 4 - suffixCols // "  [" before the bar, "]" after it
+		if barCols < minBarCols {
+			cols := max(w-2-suffixCols, minBarNameCols)
+			lines = append(lines, marker+padRunes(truncateRunes(name, cols), cols)+suffix)
+			continue
+		}
+		lines = append(lines, marker+padRunes(truncateRunes(name, nameCols), nameCols)+
+			"  "+colorDim+"["+colorReset+colorCyan+progressBar(frac, barCols)+colorReset+colorDim+"]"+colorReset+suffix)
+	}
+	return lines
+}
+
+// sectionRule is a dashboard section heading: "── TITLE ─────".
+func sectionRule(title string, w int) string {
+	return fmt.Sprintf("%s%s── %s %s%s", colorBold, colorCyan, title, strings.Repeat("─", max(w-len([]rune(title))-5, 0)), colorReset)
+}
+
+// dashboardReporter adds a device's finished, failed and deleted files to
+// the dashboard's log pane and shows its stats.
+type dashboardReporter struct {
+	d *dashboard
+}
+
+func (r dashboardReporter) Start(stats *SyncStats) {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+	r.d.stats = stats
+}
+
+func (r dashboardReporter) FileChecked(string, bool, time.Duration) {}
+func (r dashboardReporter) FileSkipped(string, int64)               {}
+
+func (r dashboardReporter) FileDownloaded(relPath string, bytes int64, _ time.Duration) {
+	r.d.addLog(fmt.Sprintf("%s✓%s %s (%s)", colorGreen, colorReset, relPath, formatBytes(bytes)))
+}
+
+func (r dashboardReporter) FileFailed(relPath string, err error) {
+	r.d.addLog(fmt.Sprintf("%s✗ %s: %v%s", colorRed, relPath, err, colorReset))
+}
+
+func (r dashboardReporter) FileCancelled(relPath string) {
+	r.d.addLog(fmt.Sprintf("%s⚠ %s: %v%s", colorYellow, relPath, errSkipped, colorReset))
+}
+
+func (r dashboardReporter) FileDeleted(path string) {
+	r.d.addLog(fmt.Sprintf("%s-%s %s", colorYellow, colorReset, path))
+}
+
+// Stop leaves the final stats on screen until the next device starts.
+func (r dashboardReporter) Stop(*SyncStats) {}
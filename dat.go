@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/xml"
+	"os"
+	"strings"
+)
+
+// datROM is one <rom> entry of a Logiqx XML DAT file, as published by
+// No-Intro, Redump and MAME.
+type datROM struct {
+	Name string `xml:"name,attr"`
+	Size int64  `xml:"size,attr"`
+	CRC  string `xml:"crc,attr"`
+	SHA1 string `xml:"sha1,attr"`
+}
+
+// datIndex maps lower-cased ROM names to their DAT entries.
+type datIndex map[string][]datROM
+
+// loadDAT reads a Logiqx XML DAT file. Both <game> (No-Intro, Redump) and
+// <machine> (MAME) entries are indexed.
+func loadDAT(path string) (datIndex, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	type set struct {
+		ROMs []datROM `xml:"rom"`
+	}
+	var dat struct {
+		Games    []set `xml:"game"`
+		Machines []set `xml:"machine"`
+	}
+	if err := xml.NewDecoder(file).Decode(&dat); err != nil {
+		return nil, err
+	}
+
+	index := make(datIndex)
+	for _, s := range append(dat.Games, dat.Machines...) {
+		for _, rom := range s.ROMs {
+			key := strings.ToLower(rom.Name)
+			index[key] = append(index[key], rom)
+		}
+	}
+	return index, nil
+}
+
+// Match returns the entry for name whose size and CRC32 (hex) match, and
+// whether any entry with that name exists at all.
+func (d datIndex) Match(name string, size int64, crc string) (rom datROM, matched, known bool) {
+	entries, known := d[strings.ToLower(name)]
+	for _, entry := range entries {
+		if entry.Size == size && strings.EqualFold(entry.CRC, crc) {
+			return entry, true, true
+		}
+	}
+	return datROM{}, false, known
+}
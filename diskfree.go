@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// freeSpaceInterval is how often free space is checked during a sync when
+// min_free_space is set.
+const freeSpaceInterval = 2 * time.Second
+
+// freeSpaceAt returns the bytes available to the current user on the
+// filesystem holding path. path need not exist yet; its nearest existing
+// ancestor is queried. ok is false if free space cannot be determined.
+func freeSpaceAt(path string) (free int64, ok bool) {
+	dir, ok := existingAncestor(path)
+	if !ok {
+		return 0, false
+	}
+	return freeSpace(dir)
+}
+
+// existingAncestor returns path made absolute, or its nearest ancestor that
+// exists.
+func existingAncestor(path string) (string, bool) {
+	dir, err := filepath.Abs(path)
+	if err != nil {
+		return "", false
+	}
+	for {
+		if _, err := os.Stat(dir); err == nil {
+			return dir, true
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
+
+// freeSpaceShortfalls is the disk space preflight for a whole run: it
+// checks every device's remaining download plus its min_free_space against
+// the free space of its destination filesystem, counting the devices before
+// it on the same filesystem, so that an early device cannot fill the disk a
+// later one needs. A device that does not fit is left out of the count, and
+// its message is returned keyed by its index. Devices without a plan, or
+// whose free space cannot be determined, are not checked.
+func freeSpaceShortfalls(plans []*devicePlan, settings []SyncSettings) map[int]string {
+	shortfalls := make(map[int]string)
+	planned := make(map[string]int64) // filesystem → bytes needed by earlier devices
+	for i, plan := range plans {
+		if plan == nil {
+			continue
+		}
+		dir, ok := existingAncestor(plan.LocalDir)
+		if !ok {
+			continue
+		}
+		free, ok := freeSpace(dir)
+		if !ok {
+			continue
+		}
+		fs, _ := filesystemID(dir) // unidentified filesystems are all counted as one
+
+		need := bytesToDownload(plan.Checks)
+		earlier := planned[fs]
+		if earlier+need+settings[i].MinFreeSpace <= free {
+			planned[fs] += need
+			continue
+		}
+		msg := fmt.Sprintf("not enough free space: %s to download", formatBytes(need))
+		if earlier > 0 {
+			msg += fmt.Sprintf(" + %s for earlier devices", formatBytes(earlier))
+		}
+		if settings[i].MinFreeSpace > 0 {
+			msg += fmt.Sprintf(" + %s min_free_space", formatBytes(settings[i].MinFreeSpace))
+		}
+		shortfalls[i] = msg + fmt.Sprintf(", %s available", formatBytes(free))
+	}
+	return shortfalls
+}
+
+// bytesToDownload estimates how many more bytes the checked tasks will take
+// on disk: what is left to download minus the size of any local copy it
+// replaces. Files that are already up to date count as zero.
+func bytesToDownload(checks []taskCheck) int64 {
+	var total int64
+	for _, check := range checks {
+		need := check.Bytes()
+		if info, err := os.Stat(check.LocalPath); err == nil && need > 0 {
+			need -= info.Size()
+		}
+		if need > 0 {
+			total += need
+		}
+	}
+	return total
+}
+
+// watchFreeSpace returns a channel that is closed once free space at dir
+// drops below minFree. It polls until stop is closed. With minFree 0 the
+// returned channel is nil and never fires.
+func watchFreeSpace(dir string, minFree int64, stop <-chan struct{}) <-chan struct{} {
+	if minFree <= 0 {
+		return nil
+	}
+	low := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(freeSpaceInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if free, ok := freeSpaceAt(dir); ok && free < minFree {
+					close(low)
+					return
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return low
+}
@@ -0,0 +1,13 @@
+//go:build !linux && !darwin && !windows
+
+package main
+
+// freeSpace is not implemented on this platform; the disk space preflight
+// and min_free_space are skipped.
+func freeSpace(dir string) (int64, bool) {
+	return 0, false
+}
+
+func filesystemID(dir string) (string, bool) {
+	return "", false
+}
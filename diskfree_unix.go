@@ -0,0 +1,28 @@
+//go:build linux || darwin
+
+package main
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// freeSpace returns the bytes available to unprivileged users on the
+// filesystem holding dir.
+func freeSpace(dir string) (int64, bool) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return 0, false
+	}
+	return int64(uint64(st.Bavail) * uint64(st.Bsize)), true
+}
+
+// filesystemID identifies the filesystem holding dir, so that devices
+// sharing free space can be told apart from those that do not.
+func filesystemID(dir string) (string, bool) {
+	var st syscall.Stat_t
+	if err := syscall.Stat(dir, &st); err != nil {
+		return "", false
+	}
+	return fmt.Sprint(st.Dev), true
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+var procGetDiskFreeSpaceExW = kernel32.NewProc("GetDiskFreeSpaceExW")
+
+// freeSpace returns the bytes available to the current user (honouring
+// quotas) on the volume holding dir.
+func freeSpace(dir string) (int64, bool) {
+	name, err := syscall.UTF16PtrFromString(dir)
+	if err != nil {
+		return 0, false
+	}
+	var freeToCaller uint64
+	ret, _, _ := procGetDiskFreeSpaceExW.Call(uintptr(unsafe.Pointer(name)), uintptr(unsafe.Pointer(&freeToCaller)), 0, 0)
+	if ret == 0 {
+		return 0, false
+	}
+	return int64(freeToCaller), true
+}
+
+// filesystemID identifies the volume holding dir, an absolute path, so that
+// devices sharing free space can be told apart from those that do not.
+func filesystemID(dir string) (string, bool) {
+	volume := filepath.VolumeName(dir)
+	return strings.ToUpper(volume), volume != ""
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// eventProgressInterval is how often a running sync emits a progress event.
+const eventProgressInterval = 5 * time.Second
+
+// eventWriter writes the newline-delimited JSON event stream selected by
+// -output json. Each line is one event.
+type eventWriter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// events is nil unless -output json is given.
+var events *eventWriter
+
+// event is the envelope of every line in the stream. Device is the remote
+// path of the device the event belongs to, empty for run-level events.
+type event struct {
+	Event  string    `json:"event"`
+	Time   time.Time `json:"time"`
+	Device string    `json:"device,omitempty"`
+	Data   any       `json:"data,omitempty"`
+}
+
+// startEventOutput switches to the JSON event stream: events are written to
+// stdout, and the human-readable output moves to stderr in plain mode so
+// stdout carries nothing but events.
+func startEventOutput() {
+	events = &eventWriter{enc: json.NewEncoder(os.Stdout)}
+	os.Stdout = os.Stderr
+	setPlainOutput()
+}
+
+// emitEvent writes one event. It does nothing unless -output json is given.
+func emitEvent(name, device string, data any) {
+	if events == nil {
+		return
+	}
+	events.mu.Lock()
+	defer events.mu.Unlock()
+	events.enc.Encode(event{Event: name, Time: time.Now().UTC(), Device: device, Data: data})
+}
+
+// Event payloads, one type per event name.
+
+type runStartEvent struct {
+	BaseURL     string `json:"base_url"`
+	Devices     int    `json:"devices"`
+	RetryFailed bool   `json:"retry_failed,omitempty"`
+}
+
+type deviceStartEvent struct {
+	Index    int    `json:"index"`
+	Total    int    `json:"total"`
+	LocalDir string `json:"local_dir"`
+}
+
+type scanCompleteEvent struct {
+	Files         int   `json:"files"`
+	Bytes         int64 `json:"bytes"`
+	DownloadFiles int   `json:"download_files"`
+	DownloadBytes int64 `json:"download_bytes"`
+	Collisions    int   `json:"collisions,omitempty"`
+}
+
+type fileCheckedEvent struct {
+	File          string `json:"file"`
+	NeedsDownload bool   `json:"needs_download"`
+	DurationMS    int64  `json:"duration_ms"`
+}
+
+type fileSkippedEvent struct {
+	File  string `json:"file"`
+	Bytes int64  `json:"bytes"`
+}
+
+type fileDownloadedEvent struct {
+	File       string `json:"file"`
+	Bytes      int64  `json:"bytes"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+type fileFailedEvent struct {
+	File  string `json:"file"`
+	Class string `json:"class"`
+	Error string `json:"error"`
+}
+
+type fileCancelledEvent struct {
+	File string `json:"file"`
+}
+
+type fileDeletedEvent struct {
+	Path string `json:"path"`
+}
+
+type deviceSummaryEvent struct {
+	SyncSummary
+	DurationMS int64  `json:"duration_ms"`
+	Drained    bool   `json:"drained,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+type runSummaryEvent struct {
+	SyncSummary
+	DevicesSynced int    `json:"devices_synced"`
+	DurationMS    int64  `json:"duration_ms"`
+	ExitCode      int    `json:"exit_code"`
+	Log           string `json:"log,omitempty"` // log file, if anything was logged
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const failedFile = "myrientor-failed.json"
+
+// Error classes recorded with each failure.
+const (
+	failClassNotFound = "not_found" // HTTP 404
+	failClassHTTP     = "http"      // any other unexpected HTTP status
+	failClassStall    = "stall"     // no data for stall_timeout on every attempt
+	failClassTimeout  = "timeout"   // connection or request timeout
+	failClassNetwork  = "network"   // DNS, connection refused, reset, TLS
+	failClassDisk     = "disk"      // creating or writing the local file
+	failClassOther    = "other"
+)
+
+// httpStatusError is an unexpected HTTP response status.
+type httpStatusError struct {
+	Code   int
+	Status string
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("HTTP %d: %s", e.Code, e.Status)
+}
+
+// classifyError maps a check or download error to a failure class.
+func classifyError(err error) string {
+	var statusErr *httpStatusError
+	var pathErr *os.PathError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &statusErr) && statusErr.Code == 404:
+		return failClassNotFound
+	case errors.As(err, &statusErr):
+		return failClassHTTP
+	case errors.Is(err, errStalled):
+		return failClassStall
+	case errors.As(err, &pathErr):
+		return failClassDisk
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return failClassTimeout
+	case errors.As(err, &netErr):
+		return failClassNetwork
+	}
+	return failClassOther
+}
+
+// failure is one file that could not be checked or downloaded.
+type failure struct {
+	Device    string    `json:"device"`     // deviceKey
+	File      string    `json:"file"`       // path relative to remote_path, slash-separated
+	Size      int64     `json:"size"`       // listed remote size
+	URL       string    `json:"url"`        // remote file URL
+	LocalPath string    `json:"local_path"` // where the file is stored, slash-separated
+	Class     string    `json:"class"`      // see failClass*
+	Error     string    `json:"error"`
+	Time      time.Time `json:"time"`
+}
+
+// FailureLog persists the files that failed in previous runs so that
+// -retry-failed can retry exactly those. Entries are keyed by local path and
+// removed once the file syncs. It is safe for concurrent use.
+type FailureLog struct {
+	mu       sync.Mutex
+	Failures map[string]failure `json:"failures"`
+}
+
+// loadFailureLog reads the failure file, returning an empty log if it does
+// not exist yet.
+func loadFailureLog() (*FailureLog, error) {
+	log := &FailureLog{Failures: make(map[string]failure)}
+	data, err := os.ReadFile(failedFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return log, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, log); err != nil {
+		return nil, fmt.Errorf("%s: %w", failedFile, err)
+	}
+	if log.Failures == nil {
+		log.Failures = make(map[string]failure)
+	}
+	return log, nil
+}
+
+// Save writes the failure file atomically, or removes it when empty.
+func (l *FailureLog) Save() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.Failures) == 0 {
+		if err := os.Remove(failedFile); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	data, err := json.MarshalIndent(l, "", "\t")
+	if err != nil {
+		return err
+	}
+	tmp := failedFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, failedFile)
+}
+
+// Record stores a failure for task, replacing any earlier one.
+func (l *FailureLog) Record(device Device, task syncTask, url string, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	localPath := filepath.ToSlash(task.LocalPath)
+	l.Failures[localPath] = failure{
+		Device:    deviceKey(device),
+		File:      task.RelPath(),
+		Size:      task.Size,
+		URL:       url,
+		LocalPath: localPath,
+		Class:     classifyError(err),
+		Error:     err.Error(),
+		Time:      time.Now(),
+	}
+}
+
+// Clear removes the failure for localPath, if any.
+func (l *FailureLog) Clear(localPath string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.Failures, filepath.ToSlash(localPath))
+}
+
+// Prune drops device failures for files that are no longer wanted, e.g.
+// because they were removed from the remote.
+func (l *FailureLog) Prune(device Device, wanted map[string]bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	key := deviceKey(device)
+	for localPath, f := range l.Failures {
+		if f.Device == key && !wanted[filepath.FromSlash(localPath)] {
+			delete(l.Failures, localPath)
+		}
+	}
+}
+
+// ForDevice returns the device's failures sorted by file.
+func (l *FailureLog) ForDevice(device Device) []failure {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	key := deviceKey(device)
+	var failures []failure
+	for _, f := range l.Failures {
+		if f.Device == key {
+			failures = append(failures, f)
+		}
+	}
+	sort.Slice(failures, func(i, j int) bool { return failures[i].File < failures[j].File })
+	return failures
+}
+
+// retryPlan builds a plan containing only the device's recorded failures,
+// without listing the remote.
+func retryPlan(device Device, settings SyncSettings, failures []failure) *devicePlan {
+	localDir, exclusive := layoutRoot(settings.Layout, device)
+	plan := &devicePlan{
+		RemoteURL: settings.BaseURL + device.RemotePath,
+		LocalDir:  localDir,
+		Exclusive: exclusive,
+		Wanted:    make(map[string]bool),
+	}
+	for _, f := range failures {
+		task := syncTask{FileInfo: fileInfoFromRelPath(f.File, f.Size), LocalPath: filepath.FromSlash(f.LocalPath)}
+		plan.Tasks = append(plan.Tasks, task)
+		plan.Wanted[task.LocalPath] = true
+		plan.TotalSize += f.Size
+	}
+	return plan
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// FileFilter selects which remote files are downloaded, using filename globs.
+// Matching is case-insensitive so "*(usa)*" matches "Tetris (USA).zip".
+type FileFilter struct {
+	Include []string // if non-empty, a file must match at least one pattern
+	Exclude []string // a file matching any pattern is never downloaded
+}
+
+// Validate checks that every pattern is a well-formed glob.
+func (f FileFilter) Validate() error {
+	for _, pattern := range append(append([]string{}, f.Include...), f.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid filter pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// Allows reports whether a file with the given name passes the filter.
+func (f FileFilter) Allows(name string) bool {
+	name = strings.ToLower(name)
+	for _, pattern := range f.Exclude {
+		if ok, _ := path.Match(strings.ToLower(pattern), name); ok {
+			return false
+		}
+	}
+	if len(f.Include) == 0 {
+		return true
+	}
+	for _, pattern := range f.Include {
+		if ok, _ := path.Match(strings.ToLower(pattern), name); ok {
+			return true
+		}
+	}
+	return false
+}
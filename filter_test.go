@@ -0,0 +1,27 @@
+package main
+
+import "testing"
+
+func TestFileFilterAllows(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter FileFilter
+		file   string
+		want   bool
+	}{
+		{"empty filter", FileFilter{}, "Tetris (World).zip", true},
+		{"include match", FileFilter{Include: []string{"*(usa)*"}}, "Tetris (USA).zip", true},
+		{"include no match", FileFilter{Include: []string{"*(usa)*"}}, "Tetris (Japan).zip", false},
+		{"include any pattern", FileFilter{Include: []string{"*(usa)*", "*(europe)*"}}, "Tetris (Europe).zip", true},
+		{"include is case-insensitive", FileFilter{Include: []string{"*(USA)*"}}, "tetris (usa).zip", true},
+		{"exclude match", FileFilter{Exclude: []string{"*(beta)*"}}, "Tetris (USA) (Beta).zip", false},
+		{"exclude beats include", FileFilter{Include: []string{"*(usa)*"}, Exclude: []string{"*(beta)*"}}, "Tetris (USA) (Beta).zip", false},
+		{"exclude no match", FileFilter{Exclude: []string{"*(beta)*"}}, "Tetris (USA).zip", true},
+		{"bracket tags", FileFilter{Include: []string{"*\\[!\\]*"}}, "Tetris [!].zip", true},
+	}
+	for _, tt := range tests {
+		if got := tt.filter.Allows(tt.file); got != tt.want {
+			t.Errorf("%s: Allows(%q) = %v, want %v", tt.name, tt.file, got, tt.want)
+		}
+	}
+}
@@ -65,18 +65,103 @@ func activityLine(prefix string, prefixCols int, name, suffix string) string {
 	return prefix + name + colorDim + strings.Repeat(".", dots) + suffix + colorReset
 }
 
+// Progress bar layout: the bar is at least minBarCols wide and the file name
+// at least minBarNameCols, else progressBarLine falls back to activityLine.
+// The name column takes at most barNameShare of the terminal width so that
+// the bars of all slots line up.
+const (
+	minBarCols     = 10
+	minBarNameCols = 12
+	barNameShare   = 0.3
+)
+
+// progressBarLine builds a full-terminal-width activity line with a
+// progress bar, for downloads of known size:
+//
+//	<prefix><name>  [███████▌      ]  42%  1.20 MiB/s  ETA 3s
+//
+// On narrow terminals the ETA and then the speed are dropped before the bar
+// gets shorter than minBarCols; below that the line degrades to activityLine.
+func progressBarLine(prefix string, prefixCols int, name string, done, total, speed int64) string {
+	frac := min(float64(done)/float64(total), 1)
+	pct := fmt.Sprintf(" %3.0f%%", frac*100)
+	rate := fmt.Sprintf("  %11s/s", formatBytes(speed))
+	eta := "  ETA --"
+	if speed > 0 {
+		eta = "  ETA " + formatDuration(time.Duration(float64(total-done)/float64(speed))*time.Second)
+	}
+	eta = fmt.Sprintf("%-13s", eta)
+
+	tw := terminalWidth()
+	for _, suffix := range []string{pct + rate + eta, pct + rate, pct} {
+		room := tw - prefixCols - len(suffix) - 4 // "  [" before the bar, "]" after it
+		nameCols := min(int(float64(tw)*barNameShare), room-minBarCols)
+		if nameCols < minBarNameCols {
+			continue
+		}
+		barCols := room - nameCols
+		return prefix + padRunes(truncateRunes(name, nameCols), nameCols) +
+			"  " + colorDim + "[" + colorReset + colorCyan + progressBar(frac, barCols) + colorReset + colorDim + "]" + colorReset +
+			suffix
+	}
+	return activityLine(prefix, prefixCols, name, strings.TrimSpace(pct))
+}
+
+// progressBar renders frac (0 to 1) as a bar of width columns, using
+// eighth blocks for the partly filled column.
+func progressBar(frac float64, width int) string {
+	eighths := int(frac * float64(width*8))
+	full, part := eighths/8, eighths%8
+	bar := strings.Repeat("█", full)
+	if full < width {
+		if part > 0 {
+			bar += string([]rune("▏▎▍▌▋▊▉")[part-1])
+			full++
+		}
+		bar += strings.Repeat(" ", width-full)
+	}
+	return bar
+}
+
+// sparkline renders values as a row of block characters scaled to the
+// largest value. Negative values mean no data and render as spaces.
+func sparkline(values []int64) string {
+	levels := []rune("▁▂▃▄▅▆▇█")
+	var peak int64
+	for _, v := range values {
+		peak = max(peak, v)
+	}
+	var b strings.Builder
+	for _, v := range values {
+		switch {
+		case v < 0:
+			b.WriteRune(' ')
+		case peak == 0:
+			b.WriteRune(levels[0])
+		default:
+			b.WriteRune(levels[min(int(v*int64(len(levels))/(peak+1)), len(levels)-1)])
+		}
+	}
+	return b.String()
+}
+
 // fitInTerminal crops name so that (overhead + len(name)) fits within the
 // terminal width. overhead is the number of display columns taken by the
 // fixed parts of the line (prefix, separator, suffix). If cropping is
 // necessary, the last character is replaced with "…".
 func fitInTerminal(name string, overhead int) string {
-	maxLen := terminalWidth() - overhead
+	return truncateRunes(name, terminalWidth()-overhead)
+}
+
+// truncateRunes crops s to at most maxLen runes (minimum 1), replacing the
+// last character with "…" if cropping is necessary.
+func truncateRunes(s string, maxLen int) string {
 	if maxLen < 1 {
 		maxLen = 1
 	}
-	runes := []rune(name)
+	runes := []rune(s)
 	if len(runes) <= maxLen {
-		return name
+		return s
 	}
 	if maxLen == 1 {
 		return "…"
@@ -84,12 +169,21 @@ func fitInTerminal(name string, overhead int) string {
 	return string(runes[:maxLen-1]) + "…"
 }
 
-func devicePanel(index, total int, path string) string {
+// padRunes pads s with spaces to width runes.
+func padRunes(s string, width int) string {
+	if n := len([]rune(s)); n < width {
+		return s + strings.Repeat(" ", width-n)
+	}
+	return s
+}
+
+// devicePanel renders the per-device title box, e.g. "Syncing: <path>".
+func devicePanel(index, total int, action, path string) string {
 	tw := terminalWidth()
 	top := panelTopLabeled(fmt.Sprintf("%d/%d", index, total))
 
-	// │  Syncing: <path>   │
-	const syncPrefix = "  Syncing: "
+	// │  <action>: <path>   │
+	syncPrefix := "  " + action + ": "
 	inner := tw - 2
 	maxPathCols := max(inner-len(syncPrefix), 1)
 	runes := []rune(path)
@@ -127,6 +221,32 @@ func stripANSI(s string) string {
 	return b.String()
 }
 
+// truncateANSI crops s to at most cols display columns, keeping its ANSI
+// color sequences, so that a line never wraps.
+func truncateANSI(s string, cols int) string {
+	var b strings.Builder
+	runes := []rune(s)
+	visible := 0
+	for i := 0; i < len(runes); i++ {
+		if runes[i] == '\033' && i+1 < len(runes) && runes[i+1] == '[' {
+			j := i + 2
+			for j < len(runes) && runes[j] != 'm' {
+				j++
+			}
+			b.WriteString(string(runes[i:min(j+1, len(runes))]))
+			i = j
+			continue
+		}
+		if visible == cols {
+			b.WriteString(colorReset)
+			break
+		}
+		b.WriteRune(runes[i])
+		visible++
+	}
+	return b.String()
+}
+
 func panelTopLabeled(label string) string {
 	tw := terminalWidth()
 	labelCols := len([]rune(label))
@@ -174,3 +294,36 @@ func formatBytes(bytes int64) string {
 	}
 	return fmt.Sprintf("%.2f %ciB", float64(bytes)/float64(div), "KMGTPE"[exp])
 }
+
+// plainOutput is set when output goes to a pipe or file, or -plain or
+// NO_COLOR is given: no colors, no cursor movement, no redrawn lines.
+var plainOutput bool
+
+// progressBars is set by -bars: activity lines show progress bars and the
+// stats panel a throughput sparkline. It has no effect in plain mode.
+var progressBars bool
+
+// setPlainOutput switches all output to plain mode.
+func setPlainOutput() {
+	plainOutput = true
+	for _, color := range []*string{&colorReset, &colorRed, &colorGreen, &colorYellow, &colorBlue, &colorMagenta, &colorCyan, &colorBold, &colorDim} {
+		*color = ""
+	}
+}
+
+// statusLine overwrites the current line with a transient progress message
+// such as "Scanning: …". It prints nothing in plain mode.
+func statusLine(format string, args ...any) {
+	if plainOutput {
+		return
+	}
+	fmt.Printf("\r"+format+"\033[K", args...)
+}
+
+// clearStatusLine erases the line written by statusLine.
+func clearStatusLine() {
+	if plainOutput {
+		return
+	}
+	fmt.Printf("\r\033[K")
+}
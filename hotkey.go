@@ -0,0 +1,165 @@
+package main
+
+import (
+	"slices"
+	"strconv"
+	"sync"
+)
+
+// keyCode identifies a decoded key press. Printable characters are reported
+// as keyRune with the character in termKey.Rune.
+type keyCode int
+
+const (
+	keyRune keyCode = iota
+	keyUp
+	keyDown
+	keyLeft
+	keyRight
+	keyPageUp
+	keyPageDown
+	keyHome
+	keyEnd
+	keyEnter
+	keyEscape
+	keyBackspace
+	keyTab
+)
+
+// hotkeyActions are the sync controls bound to keys besides drain. Nil
+// actions are ignored.
+type hotkeyActions struct {
+	pause  func()            // 'p' / 'P'
+	resize func(delta int)   // '+' / '=' grow the download pool by one, '-' / '_' shrink it
+	skip   func(slot int)    // 's', the 1-based slot number, Enter
+	prompt func(text string) // shows the skip slot number while it is typed; "" hides it
+	abort  func()            // 'x' / 'X'
+	scroll func(key keyCode) // cursor and paging keys
+}
+
+// terminalRestore undoes the terminal changes of the running key reader and
+// dashboard, so that a forced exit does not leave the terminal without echo
+// or on the alternate screen.
+var terminalRestore struct {
+	mu       sync.Mutex
+	restores []*func()
+}
+
+// onTerminalRestore registers a function for restoreTerminal to call, and
+// returns a function that unregisters it.
+func onTerminalRestore(restore func()) (remove func()) {
+	terminalRestore.mu.Lock()
+	defer terminalRestore.mu.Unlock()
+	entry := &restore
+	terminalRestore.restores = append(terminalRestore.restores, entry)
+	return func() {
+		terminalRestore.mu.Lock()
+		defer terminalRestore.mu.Unlock()
+		terminalRestore.restores = slices.DeleteFunc(terminalRestore.restores, func(e *func()) bool { return e == entry })
+	}
+}
+
+// restoreTerminal undoes the registered terminal changes, latest first.
+func restoreTerminal() {
+	terminalRestore.mu.Lock()
+	defer terminalRestore.mu.Unlock()
+	for _, restore := range slices.Backward(terminalRestore.restores) {
+		(*restore)()
+	}
+}
+
+// termKey is a single key press read from the terminal.
+type termKey struct {
+	Code keyCode
+	Rune rune // set when Code is keyRune
+}
+
+// listenForDrain starts listening for the drain hotkey ('q' / 'Q').
+// When pressed, the returned channel receives once, signalling that no new
+// files should be queued; active downloads are allowed to finish. The other
+// sync controls call their action in actions.
+//
+// The returned wait function blocks until the key reader has exited and the
+// terminal has been restored. Call it before printing final output to avoid
+// garbled display.
+func listenForDrain(done <-chan struct{}, actions hotkeyActions) (<-chan struct{}, func()) {
+	drain := make(chan struct{}, 1)
+	keys, wait, ok := readKeys(done)
+	if !ok {
+		return drain, wait
+	}
+
+	go func() {
+		// While a skip is being typed, digits build the slot number until
+		// Enter confirms or any other key cancels.
+		skipping, slot := false, 0
+		showPrompt := func(text string) {
+			if actions.prompt != nil {
+				actions.prompt(text)
+			}
+		}
+		showSlot := func() {
+			number := ""
+			if slot > 0 {
+				number = strconv.Itoa(slot)
+			}
+			showPrompt("skip slot " + number + "_")
+		}
+		for key := range keys {
+			if skipping {
+				switch {
+				case key.Code == keyRune && key.Rune >= '0' && key.Rune <= '9':
+					slot = min(slot*10+int(key.Rune-'0'), 999)
+					showSlot()
+				case key.Code == keyBackspace:
+					slot /= 10
+					showSlot()
+				case key.Code == keyEnter:
+					skipping = false
+					showPrompt("")
+					if actions.skip != nil && slot > 0 {
+						actions.skip(slot)
+					}
+				default:
+					skipping = false
+					showPrompt("")
+				}
+				continue
+			}
+			if key.Code != keyRune {
+				if actions.scroll != nil {
+					actions.scroll(key.Code)
+				}
+				continue
+			}
+			switch key.Rune {
+			case 'q', 'Q':
+				select {
+				case drain <- struct{}{}:
+				default:
+				}
+			case 'p', 'P':
+				if actions.pause != nil {
+					actions.pause()
+				}
+			case '+', '=':
+				if actions.resize != nil {
+					actions.resize(1)
+				}
+			case '-', '_':
+				if actions.resize != nil {
+					actions.resize(-1)
+				}
+			case 's', 'S':
+				skipping, slot = true, 0
+				showSlot()
+			case 'x', 'X':
+				if actions.abort != nil {
+					actions.abort()
+				}
+			}
+		}
+	}()
+
+	return drain, wait
+}
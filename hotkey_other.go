@@ -2,7 +2,7 @@
 
 package main
 
-// listenForDrain is a no-op stub on unsupported platforms.
-func listenForDrain(_ <-chan struct{}) (<-chan struct{}, func()) {
-	return make(chan struct{}), func() {}
+// readKeys is a no-op stub on unsupported platforms.
+func readKeys(_ <-chan struct{}) (<-chan termKey, func(), bool) {
+	return nil, func() {}, false
 }
@@ -0,0 +1,173 @@
+//go:build linux || darwin
+
+package main
+
+import (
+	"os"
+	"syscall"
+	"time"
+	"unicode/utf8"
+	"unsafe"
+)
+
+// readKeys switches the terminal to raw mode and delivers decoded key
+// presses until done is closed. ok is false if stdin is not a terminal.
+//
+// The returned wait function blocks until the reader has exited and the
+// terminal has been restored.
+func readKeys(done <-chan struct{}) (keys <-chan termKey, wait func(), ok bool) {
+	// Save original terminal state. If stdin is not a terminal, bail out.
+	var orig syscall.Termios
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL,
+		uintptr(syscall.Stdin),
+		ioctlGetTermios,
+		uintptr(unsafe.Pointer(&orig))); errno != 0 {
+		return nil, func() {}, false
+	}
+
+	keyCh := make(chan termKey, 16)
+	finished := make(chan struct{})
+
+	go func() {
+		defer close(finished)
+		defer close(keyCh)
+
+		// Enable raw mode: no echo, no line buffering.
+		// ISIG is intentionally kept so Ctrl-C still sends SIGINT.
+		raw := orig
+		raw.Lflag &^= syscall.ICANON | syscall.ECHO
+		syscall.Syscall(syscall.SYS_IOCTL,
+			uintptr(syscall.Stdin),
+			ioctlSetTermios,
+			uintptr(unsafe.Pointer(&raw)))
+		restore := func() {
+			syscall.Syscall(syscall.SYS_IOCTL,
+				uintptr(syscall.Stdin),
+				ioctlSetTermios,
+				uintptr(unsafe.Pointer(&orig)))
+		}
+		defer restore()
+		defer onTerminalRestore(restore)()
+
+		// Make stdin non-blocking so the reader goroutine can exit cleanly
+		// when this goroutine is done (important for multi-device syncs).
+		syscall.SetNonblock(syscall.Stdin, true)
+		defer syscall.SetNonblock(syscall.Stdin, false)
+
+		innerDone := make(chan struct{})
+		chunkCh := make(chan []byte, 4)
+		go func() {
+			buf := make([]byte, 64)
+			for {
+				n, err := os.Stdin.Read(buf)
+				if n > 0 {
+					select {
+					case chunkCh <- append([]byte(nil), buf[:n]...):
+					case <-innerDone:
+						return
+					}
+				}
+				if err != nil {
+					// EAGAIN (non-blocking, no data yet) or real error.
+					// Poll until data arrives or we are asked to stop.
+					select {
+					case <-innerDone:
+						return
+					case <-time.After(50 * time.Millisecond):
+					}
+				}
+			}
+		}()
+
+		for {
+			select {
+			case <-done:
+				close(innerDone)
+				return
+			case chunk := <-chunkCh:
+				for _, key := range decodeKeys(chunk) {
+					select {
+					case keyCh <- key:
+					case <-done:
+						close(innerDone)
+						return
+					}
+				}
+			}
+		}
+	}()
+
+	return keyCh, func() { <-finished }, true
+}
+
+// decodeKeys turns raw terminal input into key presses, recognising the
+// common VT escape sequences for cursor and paging keys.
+func decodeKeys(input []byte) []termKey {
+	var keys []termKey
+	for len(input) > 0 {
+		if input[0] == 0x1b {
+			key, n := decodeEscape(input)
+			keys = append(keys, key)
+			input = input[n:]
+			continue
+		}
+
+		switch input[0] {
+		case '\r', '\n':
+			keys = append(keys, termKey{Code: keyEnter})
+			input = input[1:]
+			continue
+		case 0x7f, 0x08:
+			keys = append(keys, termKey{Code: keyBackspace})
+			input = input[1:]
+			continue
+		case '\t':
+			keys = append(keys, termKey{Code: keyTab})
+			input = input[1:]
+			continue
+		}
+
+		r, size := utf8.DecodeRune(input)
+		keys = append(keys, termKey{Code: keyRune, Rune: r})
+		input = input[size:]
+	}
+	return keys
+}
+
+// decodeEscape decodes an escape sequence at the start of input and returns
+// the key and the number of bytes consumed. A lone ESC is the Escape key.
+func decodeEscape(input []byte) (termKey, int) {
+	if len(input) < 3 || (input[1] != '[' && input[1] != 'O') {
+		return termKey{Code: keyEscape}, 1
+	}
+
+	switch input[2] {
+	case 'A':
+		return termKey{Code: keyUp}, 3
+	case 'B':
+		return termKey{Code: keyDown}, 3
+	case 'C':
+		return termKey{Code: keyRight}, 3
+	case 'D':
+		return termKey{Code: keyLeft}, 3
+	case 'H':
+		return termKey{Code: keyHome}, 3
+	case 'F':
+		return termKey{Code: keyEnd}, 3
+	}
+
+	// ESC [ <n> ~ sequences
+	if len(input) >= 4 && input[3] == '~' {
+		switch input[2] {
+		case '1', '7':
+			return termKey{Code: keyHome}, 4
+		case '4', '8':
+			return termKey{Code: keyEnd}, 4
+		case '5':
+			return termKey{Code: keyPageUp}, 4
+		case '6':
+			return termKey{Code: keyPageDown}, 4
+		}
+	}
+	return termKey{Code: keyEscape}, 1
+}
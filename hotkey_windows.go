@@ -35,39 +35,56 @@ type inputRecord struct {
 	Control   uint32  // DWORD dwControlKeyState
 }
 
-// listenForDrain starts listening for the drain hotkey ('q' / 'Q').
-// When pressed, the returned channel receives once, signalling that no new
-// files should be queued; active downloads are allowed to finish.
+// Virtual-key codes for the non-character keys readKeys reports.
+const (
+	vkBack   = 0x08
+	vkTab    = 0x09
+	vkReturn = 0x0D
+	vkEscape = 0x1B
+	vkPrior  = 0x21
+	vkNext   = 0x22
+	vkEnd    = 0x23
+	vkHome   = 0x24
+	vkLeft   = 0x25
+	vkUp     = 0x26
+	vkRight  = 0x27
+	vkDown   = 0x28
+)
+
+// readKeys switches the console to raw input and delivers decoded key
+// presses until done is closed. ok is false if stdin is not a console.
 //
-// The returned wait function blocks until the goroutine has exited and the
-// console mode has been restored. Call it before printing final output to
-// avoid garbled display.
-func listenForDrain(done <-chan struct{}) (<-chan struct{}, func()) {
-	drain := make(chan struct{}, 1)
+// The returned wait function blocks until the reader has exited and the
+// console mode has been restored.
+func readKeys(done <-chan struct{}) (keys <-chan termKey, wait func(), ok bool) {
+	// Get the stdin console handle.
+	hStdin, _, _ := procGetStdHandle.Call(stdInputHandle)
+	if hStdin == 0 || hStdin == ^uintptr(0) {
+		return nil, func() {}, false
+	}
+
+	// Save original console mode. If stdin is not a console (e.g.
+	// redirected from a file), GetConsoleMode returns 0 and we bail out.
+	var origMode uint32
+	ret, _, _ := procGetConsoleMode.Call(hStdin, uintptr(unsafe.Pointer(&origMode)))
+	if ret == 0 {
+		return nil, func() {}, false
+	}
+
+	keyCh := make(chan termKey, 16)
 	finished := make(chan struct{})
 
 	go func() {
 		defer close(finished)
-
-		// Get the stdin console handle.
-		hStdin, _, _ := procGetStdHandle.Call(stdInputHandle)
-		if hStdin == 0 || hStdin == ^uintptr(0) {
-			return
-		}
-
-		// Save original console mode. If stdin is not a console (e.g.
-		// redirected from a file), GetConsoleMode returns 0 and we bail out.
-		var origMode uint32
-		ret, _, _ := procGetConsoleMode.Call(hStdin, uintptr(unsafe.Pointer(&origMode)))
-		if ret == 0 {
-			return
-		}
+		defer close(keyCh)
 
 		// Disable line input and echo; keep ENABLE_PROCESSED_INPUT so
 		// Ctrl-C still generates a CTRL_C_EVENT / SIGINT.
 		rawMode := origMode &^ uint32(enableLineInput|enableEchoInput)
 		procSetConsoleMode.Call(hStdin, uintptr(rawMode))
-		defer procSetConsoleMode.Call(hStdin, uintptr(origMode))
+		restore := func() { procSetConsoleMode.Call(hStdin, uintptr(origMode)) }
+		defer restore()
+		defer onTerminalRestore(restore)()
 
 		for {
 			// Check for shutdown before blocking.
@@ -96,14 +113,52 @@ func listenForDrain(done <-chan struct{}) (<-chan struct{}, func()) {
 			if numRead == 0 || rec.EventType != keyEvent || rec.KeyDown == 0 {
 				continue
 			}
-			if rec.Char == 'q' || rec.Char == 'Q' {
-				select {
-				case drain <- struct{}{}:
-				default:
-				}
+			key, ok := decodeKeyRecord(rec)
+			if !ok {
+				continue
+			}
+			select {
+			case keyCh <- key:
+			case <-done:
+				return
 			}
 		}
 	}()
 
-	return drain, func() { <-finished }
+	return keyCh, func() { <-finished }, true
+}
+
+// decodeKeyRecord maps a console key event to a key press. Modifier-only
+// events (Shift, Ctrl, ...) carry no character and are ignored.
+func decodeKeyRecord(rec inputRecord) (termKey, bool) {
+	switch rec.VK {
+	case vkBack:
+		return termKey{Code: keyBackspace}, true
+	case vkTab:
+		return termKey{Code: keyTab}, true
+	case vkReturn:
+		return termKey{Code: keyEnter}, true
+	case vkEscape:
+		return termKey{Code: keyEscape}, true
+	case vkPrior:
+		return termKey{Code: keyPageUp}, true
+	case vkNext:
+		return termKey{Code: keyPageDown}, true
+	case vkEnd:
+		return termKey{Code: keyEnd}, true
+	case vkHome:
+		return termKey{Code: keyHome}, true
+	case vkLeft:
+		return termKey{Code: keyLeft}, true
+	case vkUp:
+		return termKey{Code: keyUp}, true
+	case vkRight:
+		return termKey{Code: keyRight}, true
+	case vkDown:
+		return termKey{Code: keyDown}, true
+	}
+	if rec.Char == 0 {
+		return termKey{}, false
+	}
+	return termKey{Code: keyRune, Rune: rune(rec.Char)}, true
 }
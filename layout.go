@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// defaultLayout mirrors the remote directory structure under local_path.
+const defaultLayout = "{local_path}/{remote_path}/{subdir}/{name}"
+
+var layoutPlaceholder = regexp.MustCompile(`\{[^}]*\}`)
+
+// validateLayout checks that a layout template only uses known placeholders
+// and ends in the file name.
+func validateLayout(layout string) error {
+	for _, placeholder := range layoutPlaceholder.FindAllString(layout, -1) {
+		switch placeholder {
+		case "{local_path}", "{remote_path}", "{subdir}", "{name}":
+		default:
+			return fmt.Errorf("unknown placeholder %s in layout %q", placeholder, layout)
+		}
+	}
+	if !strings.HasSuffix(layout, "{name}") {
+		return fmt.Errorf("layout %q must end with {name}", layout)
+	}
+	return nil
+}
+
+// renderLayout expands a layout template into a slash-separated path.
+func renderLayout(layout string, device Device, subDir, name string) string {
+	replacer := strings.NewReplacer(
+		"{local_path}", filepath.ToSlash(device.LocalPath),
+		"{remote_path}", strings.Trim(device.RemotePath, "/"),
+		"{subdir}", subDir,
+		"{name}", name,
+	)
+	return path.Clean(replacer.Replace(layout))
+}
+
+// layoutFilePath returns the local path a remote file is stored at.
+func layoutFilePath(layout string, device Device, file FileInfo) string {
+	return filepath.FromSlash(renderLayout(layout, device, file.SubDir, file.Name))
+}
+
+// layoutRoot returns the directory under which all of a device's files are
+// stored: the part of the layout before {subdir} or {name}. exclusive is true
+// when the root contains {remote_path}, meaning no other device shares it and
+// any file inside it that is not on the remote can be cleaned up.
+func layoutRoot(layout string, device Device) (root string, exclusive bool) {
+	prefix := layout
+	for _, placeholder := range []string{"{subdir}", "{name}"} {
+		if i := strings.Index(prefix, placeholder); i >= 0 {
+			prefix = prefix[:i]
+		}
+	}
+	exclusive = strings.Contains(prefix, "{remote_path}")
+	return filepath.FromSlash(renderLayout(prefix, device, "", "")), exclusive
+}
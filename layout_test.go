@@ -0,0 +1,49 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestValidateLayout(t *testing.T) {
+	tests := []struct {
+		layout  string
+		wantErr bool
+	}{
+		{defaultLayout, false},
+		{"{local_path}/{name}", false},
+		{"{local_path}/roms/{remote_path}/{name}", false},
+		{"/mnt/roms/{subdir}/{name}", false},
+		{"{local_path}/{system}/{name}", true},
+		{"{local_path}/{name}/", true},
+		{"{local_path}/{remote_path}", true},
+		{"{local_path}/{Name}", true},
+	}
+	for _, tt := range tests {
+		err := validateLayout(tt.layout)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("validateLayout(%q) error = %v, wantErr %v", tt.layout, err, tt.wantErr)
+		}
+	}
+}
+
+func TestLayoutRoot(t *testing.T) {
+	device := Device{RemotePath: "No-Intro/Nintendo/", LocalPath: "/roms/nes"}
+	tests := []struct {
+		layout        string
+		wantRoot      string
+		wantExclusive bool
+	}{
+		{defaultLayout, "/roms/nes/No-Intro/Nintendo", true},
+		{"{local_path}/{name}", "/roms/nes", false},
+		{"{local_path}/{subdir}/{name}", "/roms/nes", false},
+		{"{local_path}/{remote_path}/{name}", "/roms/nes/No-Intro/Nintendo", true},
+		{"/mnt/{remote_path}/all/{subdir}/{name}", "/mnt/No-Intro/Nintendo/all", true},
+	}
+	for _, tt := range tests {
+		root, exclusive := layoutRoot(tt.layout, device)
+		if root != filepath.FromSlash(tt.wantRoot) || exclusive != tt.wantExclusive {
+			t.Errorf("layoutRoot(%q) = %q, %v, want %q, %v", tt.layout, root, exclusive, tt.wantRoot, tt.wantExclusive)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// deviceListing is one row of `myrientor list`.
+type deviceListing struct {
+	RemotePath string    `json:"remote_path"`
+	LocalPath  string    `json:"local_path"`
+	LocalDir   string    `json:"local_dir"`
+	Enabled    bool      `json:"enabled"`
+	Files      int       `json:"files"`
+	Bytes      int64     `json:"bytes"`
+	LastSync   time.Time `json:"last_sync,omitzero"`
+}
+
+// runListCommand implements `myrientor list`: every configured device with
+// its local file count, size on disk, and last successful sync.
+func runListCommand(args []string) int {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	flags := registerFlags(fs)
+	enabledOnly := fs.Bool("enabled", false, "Only list devices that would be synced")
+	match := fs.String("match", "", "Only list devices whose local_path or remote_path matches this glob or substring")
+	jsonOutput := fs.Bool("json", false, "Print JSON instead of a table")
+	fs.Parse(args)
+
+	cfg, err := loadConfig(flags)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s✗ Config error: %v%s\n", colorRed, err, colorReset)
+		return exitConfig
+	}
+	state, err := loadSyncState()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s✗ Error reading state file %s: %v%s\n", colorRed, stateFile, err, colorReset)
+		return exitConfig
+	}
+
+	// "Enabled" means selected by the same rules a sync run would use.
+	selected := make(map[string]bool)
+	if devices, err := cfg.SelectDevices(); err == nil {
+		for _, device := range devices {
+			selected[device.RemotePath+"|"+device.LocalPath] = true
+		}
+	}
+
+	var listings []deviceListing
+	for _, device := range cfg.Remote.Devices {
+		if cfg.Profile.LocalRoot != "" && device.LocalPath != "" {
+			device.LocalPath = filepath.Join(cfg.Profile.LocalRoot, device.LocalPath)
+		}
+		enabled := selected[device.RemotePath+"|"+device.LocalPath]
+		if *enabledOnly && !enabled {
+			continue
+		}
+		if *match != "" && !device.matches(*match) &&
+			!strings.Contains(strings.ToLower(device.RemotePath+" "+device.LocalPath), strings.ToLower(*match)) {
+			continue
+		}
+
+		settings, err := cfg.DeviceSettings(device)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s✗ Invalid settings for %s: %v%s\n", colorRed, device.RemotePath, err, colorReset)
+			return exitConfig
+		}
+		localDir, _ := layoutRoot(settings.Layout, device)
+		files, bytes := localUsage(device, settings, state)
+		listings = append(listings, deviceListing{
+			RemotePath: device.RemotePath,
+			LocalPath:  device.LocalPath,
+			LocalDir:   localDir,
+			Enabled:    enabled,
+			Files:      files,
+			Bytes:      bytes,
+			LastSync:   state.LastSync(device),
+		})
+	}
+
+	if *jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetEscapeHTML(false)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(listings); err != nil {
+			fmt.Fprintf(os.Stderr, "%s✗ %v%s\n", colorRed, err, colorReset)
+			return exitErrors
+		}
+		return exitOK
+	}
+
+	printDeviceListings(listings)
+	return exitOK
+}
+
+// localUsage counts the files a device has on disk and their total size.
+// Devices with an exclusive local root are measured by walking it; devices
+// sharing a folder are measured from the files the state says they own.
+func localUsage(device Device, settings SyncSettings, state *SyncState) (files int, bytes int64) {
+	root, exclusive := layoutRoot(settings.Layout, device)
+	if !exclusive {
+		for _, path := range state.OwnedFiles(device) {
+			if info, err := os.Stat(path); err == nil {
+				files++
+				bytes += info.Size()
+			}
+		}
+		return files, bytes
+	}
+
+	filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return nil
+		}
+		files++
+		bytes += info.Size()
+		return nil
+	})
+	return files, bytes
+}
+
+// printDeviceListings renders listings as a table cropped to the terminal.
+func printDeviceListings(listings []deviceListing) {
+	// marker, local path, files, size and last sync columns plus separators
+	const fixedCols = 2 + 2 + 12 + 2 + 8 + 2 + 11 + 2 + 16
+	remoteCols := max(terminalWidth()-fixedCols, 20)
+
+	enabledCount := 0
+	var totalFiles int
+	var totalBytes int64
+	for _, l := range listings {
+		marker := colorDim + "·" + colorReset
+		if l.Enabled {
+			marker = colorGreen + "✓" + colorReset
+			enabledCount++
+		}
+		lastSync := colorDim + "never" + colorReset
+		if !l.LastSync.IsZero() {
+			lastSync = l.LastSync.Local().Format("2006-01-02 15:04")
+		}
+		fmt.Printf("%s %s  %s%s%s  %8d  %11s  %s\n",
+			marker,
+			padRunes(truncateRunes(l.RemotePath, remoteCols), remoteCols),
+			colorMagenta, padRunes(truncateRunes(l.LocalPath, 12), 12), colorReset,
+			l.Files, formatBytes(l.Bytes), lastSync)
+		totalFiles += l.Files
+		totalBytes += l.Bytes
+	}
+
+	fmt.Printf("%s%d device(s), %d enabled, %d file(s), %s on disk%s\n",
+		colorBold, len(listings), enabledCount, totalFiles, formatBytes(totalBytes), colorReset)
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultLogLevel   = "warn"
+	defaultLogFormat  = logFormatText
+	defaultLogMaxSize = "10 MiB"
+	logMaxBackups     = 3 // rotated files kept per run: name.log.1 … name.log.3
+
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+// levelAudit marks the entries written by log_audit for successful
+// downloads and deletions. They are written whatever log_level is.
+const levelAudit = slog.Level(2)
+
+// logOptions is the resolved logging configuration.
+type logOptions struct {
+	Level   slog.Level
+	Format  string // logFormatText or logFormatJSON
+	Dir     string // directory for log files; empty means the working directory
+	MaxSize int64  // rotate when the file would grow past this; 0 disables rotation
+	Audit   bool   // also log successful downloads and deletions
+}
+
+// parseLogLevel parses debug, info, warn or error.
+func parseLogLevel(s string) (slog.Level, error) {
+	switch strings.ToLower(s) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return 0, fmt.Errorf("log_level %q must be debug, info, warn or error", s)
+}
+
+// Logger writes leveled, structured entries to a timestamped log file in
+// text (key=value) or JSON-lines format. The file is created on the first
+// entry, so a run with nothing to report leaves no file behind.
+type Logger struct {
+	level  slog.Level
+	audit  bool
+	logger *slog.Logger
+	out    *rotatingFile
+	errors *atomic.Int64 // shared with loggers derived by With
+}
+
+// NewLogger creates a logger writing to myrientor_<timestamp>.log in
+// opts.Dir.
+func NewLogger(opts logOptions) *Logger {
+	timestamp := time.Now().Format("2006-01-02_15-04-05")
+	out := &rotatingFile{
+		path:    filepath.Join(opts.Dir, "myrientor_"+timestamp+".log"),
+		maxSize: opts.MaxSize,
+	}
+
+	handlerOpts := &slog.HandlerOptions{
+		Level: slog.LevelDebug, // filtered by Logger so audit entries bypass the level
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.LevelKey && a.Value.Any() == levelAudit {
+				a.Value = slog.StringValue("AUDIT")
+			}
+			return a
+		},
+	}
+	var handler slog.Handler
+	if opts.Format == logFormatJSON {
+		handler = slog.NewJSONHandler(out, handlerOpts)
+	} else {
+		handler = slog.NewTextHandler(out, handlerOpts)
+	}
+
+	return &Logger{
+		level:  opts.Level,
+		audit:  opts.Audit,
+		logger: slog.New(handler),
+		out:    out,
+		errors: new(atomic.Int64),
+	}
+}
+
+// With returns a logger that adds the given fields to every entry, e.g.
+// the device being synced.
+func (l *Logger) With(args ...any) *Logger {
+	derived := *l
+	derived.logger = l.logger.With(args...)
+	return &derived
+}
+
+func (l *Logger) log(level slog.Level, msg string, args ...any) {
+	if level < l.level {
+		return
+	}
+	l.logger.Log(context.Background(), level, msg, args...)
+}
+
+// Debug logs diagnostic detail such as individual retries.
+func (l *Logger) Debug(msg string, args ...any) { l.log(slog.LevelDebug, msg, args...) }
+
+// Info logs normal progress such as a device starting or finishing.
+func (l *Logger) Info(msg string, args ...any) { l.log(slog.LevelInfo, msg, args...) }
+
+// Warn logs a problem the sync recovered from. err may be nil.
+func (l *Logger) Warn(msg string, err error, args ...any) {
+	l.log(slog.LevelWarn, msg, append(args, errorAttrs(err)...)...)
+}
+
+// Error logs a failure and counts it for the run summary. err may be nil.
+func (l *Logger) Error(msg string, err error, args ...any) {
+	l.errors.Add(1)
+	l.log(slog.LevelError, msg, append(args, errorAttrs(err)...)...)
+}
+
+// Audit logs a successful download or deletion if log_audit is enabled.
+func (l *Logger) Audit(msg string, args ...any) {
+	if l.audit {
+		l.logger.Log(context.Background(), levelAudit, msg, args...)
+	}
+}
+
+// Close closes the log file if it was opened
+func (l *Logger) Close() {
+	l.out.Close()
+}
+
+// Count returns the number of errors logged
+func (l *Logger) Count() int {
+	return int(l.errors.Load())
+}
+
+// Filename returns the log filename
+func (l *Logger) Filename() string {
+	return l.out.path
+}
+
+// Written reports whether anything has been logged, i.e. the file exists.
+func (l *Logger) Written() bool {
+	l.out.mu.Lock()
+	defer l.out.mu.Unlock()
+	return l.out.opened
+}
+
+// errorAttrs returns the structured fields describing err: its class, the
+// HTTP status if it is one, and the message. It returns nothing for nil.
+func errorAttrs(err error) []any {
+	if err == nil {
+		return nil
+	}
+	attrs := []any{"class", classifyError(err)}
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) {
+		attrs = append(attrs, "status", statusErr.Code)
+	}
+	return append(attrs, "error", err.Error())
+}
+
+// rotatingFile is an io.Writer appending to path, opened lazily. Once the
+// file would grow past maxSize it is renamed to path.1 (shifting older
+// backups up to logMaxBackups) and a new file is started.
+type rotatingFile struct {
+	mu      sync.Mutex
+	path    string
+	maxSize int64
+	file    *os.File
+	size    int64
+	opened  bool // the file has been created
+}
+
+func (w *rotatingFile) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file != nil && w.maxSize > 0 && w.size > 0 && w.size+int64(len(p)) > w.maxSize {
+		w.rotate()
+	}
+	if w.file == nil {
+		if err := w.open(); err != nil {
+			return len(p), nil // Silently discard if file can't be opened
+		}
+	}
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+func (w *rotatingFile) open() error {
+	if dir := filepath.Dir(w.path); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	file, err := os.OpenFile(w.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	w.file = file
+	w.opened = true
+	w.size = 0
+	if info, err := file.Stat(); err == nil {
+		w.size = info.Size()
+	}
+	return nil
+}
+
+func (w *rotatingFile) rotate() {
+	w.file.Close()
+	w.file = nil
+	for i := logMaxBackups - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", w.path, i), fmt.Sprintf("%s.%d", w.path, i+1))
+	}
+	os.Rename(w.path, w.path+".1")
+}
+
+// Close closes the file if it was opened.
+func (w *rotatingFile) Close() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file != nil {
+		w.file.Close()
+		w.file = nil
+	}
+}
@@ -1,20 +1,20 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"os"
-	"path/filepath"
 	"time"
 )
 
 // Version info - injected at build time via ldflags
 var version = "dev"
 
-const (
-	defaultMaxConcurrent = 2
+const defaultMaxConcurrent = 2
 
-	// ANSI color codes
+// ANSI color codes, cleared by setPlainOutput.
+var (
 	colorReset   = "\033[0m"
 	colorRed     = "\033[31m"
 	colorGreen   = "\033[32m"
@@ -27,80 +27,285 @@ const (
 )
 
 func main() {
+	// Piped output, cron and NO_COLOR get plain, line-oriented output.
+	if _, noColor := os.LookupEnv("NO_COLOR"); noColor || !stdoutIsTerminal() {
+		setPlainOutput()
+	}
+
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "config":
+			os.Exit(runConfigCommand(os.Args[2:]))
+		case "select":
+			os.Exit(runSelectCommand(os.Args[2:]))
+		case "list":
+			os.Exit(runListCommand(os.Args[2:]))
+		case "status", "diff":
+			os.Exit(runStatusCommand(os.Args[2:]))
+		case "verify":
+			os.Exit(runVerifyCommand(os.Args[2:]))
+		case "search":
+			os.Exit(runSearchCommand(os.Args[2:]))
+		case "get":
+			os.Exit(runGetCommand(os.Args[2:]))
+		case "adopt":
+			os.Exit(runAdoptCommand(os.Args[2:]))
+		case "prune":
+			os.Exit(runPruneCommand(os.Args[2:]))
+		}
+	}
+
+	flag.Usage = usage
 	showVersion := flag.Bool("version", false, "Show version information")
-	maxConcurrentFlag := flag.Int("concurrent", 0, "Maximum concurrent downloads")
-	syncFlag := flag.String("sync", "", "Sync specific device by remote_path")
+	plain := flag.Bool("plain", false, "Line-oriented output without colors or redrawing (default when not a terminal or NO_COLOR is set)")
+	bars := flag.Bool("bars", false, "Show progress bars for active downloads and a throughput sparkline")
+	tuiMode := flag.Bool("tui", false, "Full-screen dashboard of slots, queue, log and devices while syncing (implies -bars)")
+	output := flag.String("output", "text", "Output format: text, or json for a newline-delimited JSON event stream on stdout")
+	reportPath := flag.String("report", "", "Write a run report to this file; .json, .md or .html selects the format")
+	force := flag.Bool("force", false, "Sync even if the download will not fit in free disk space")
+	prune := flag.Bool("prune", false, "After syncing, remove empty directories, stale partial downloads and expired logs")
+	retryFailed := flag.Bool("retry-failed", false, "Only retry the files that failed in earlier runs ("+failedFile+")")
+	flags := registerFlags(flag.CommandLine)
 	flag.Parse()
 
 	if *showVersion {
 		fmt.Printf("myrientor %s\n", version)
-		os.Exit(0)
+		os.Exit(exitOK)
+	}
+	if *plain {
+		setPlainOutput()
+	}
+	progressBars = *bars || *tuiMode
+	switch *output {
+	case "text":
+	case "json":
+		startEventOutput()
+	default:
+		fmt.Fprintf(os.Stderr, "%s✗ Invalid -output %q: must be text or json%s\n", colorRed, *output, colorReset)
+		os.Exit(exitConfig)
 	}
 
-	// Determine maxConcurrent: flag > config file > default
-	maxConcurrent := defaultMaxConcurrent
-	if localConfig, err := readLocalConfigFile(); err == nil && localConfig.MaxConcurrent > 0 {
-		maxConcurrent = localConfig.MaxConcurrent
+	if *tuiMode && plainOutput {
+		fmt.Fprintf(os.Stderr, "%s✗ -tui needs a terminal and text output%s\n", colorRed, colorReset)
+		os.Exit(exitConfig)
 	}
-	if *maxConcurrentFlag > 0 {
-		maxConcurrent = *maxConcurrentFlag
+
+	if *reportPath != "" {
+		if _, err := reportFormat(*reportPath); err != nil {
+			fmt.Fprintf(os.Stderr, "%s✗ %v%s\n", colorRed, err, colorReset)
+			os.Exit(exitConfig)
+		}
 	}
 
-	// Initialize error logger
-	errLog := NewErrorLogger()
-	defer errLog.Close()
+	cfg, err := loadConfig(flags)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s✗ Config error: %v%s\n", colorRed, err, colorReset)
+		os.Exit(exitConfig)
+	}
+
+	logOpts, err := cfg.Settings().LogOptions()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s✗ Config error: %v%s\n", colorRed, err, colorReset)
+		os.Exit(exitConfig)
+	}
+	logger := NewLogger(logOpts)
+	defer logger.Close()
+
+	state, err := loadSyncState()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s✗ Error reading state file %s: %v%s\n", colorRed, stateFile, err, colorReset)
+		os.Exit(exitConfig)
+	}
 
-	remoteConfig, err := readRemoteConfigFile()
+	failures, err := loadFailureLog()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "%s✗ Error reading config file: %v%s\n", colorRed, err, colorReset)
-		os.Exit(1)
+		fmt.Fprintf(os.Stderr, "%s✗ Error reading %s: %v%s\n", colorRed, failedFile, err, colorReset)
+		os.Exit(exitConfig)
 	}
 
-	// Build list of devices to sync
 	var devicesToSync []Device
-	if *syncFlag != "" {
-		devicesToSync = remoteConfig.FindAllByPath(*syncFlag)
+	if *retryFailed {
+		devicesToSync = cfg.FailedDevices(failures)
 		if len(devicesToSync) == 0 {
-			fmt.Fprintf(os.Stderr, "%s✗ No syncable device found matching: %s%s\n", colorRed, *syncFlag, colorReset)
-			os.Exit(1)
+			fmt.Printf("%s✓ No failed files to retry%s\n", colorGreen, colorReset)
+			os.Exit(exitOK)
 		}
-	} else {
-		// Sync all enabled devices
-		for _, device := range remoteConfig.Devices {
-			if device.ShouldSync() {
-				devicesToSync = append(devicesToSync, device)
-			}
+	} else if devicesToSync, err = cfg.SelectDevices(); err != nil {
+		fmt.Fprintf(os.Stderr, "%s✗ %v%s\n", colorRed, err, colorReset)
+		os.Exit(exitConfig)
+	}
+
+	// Resolve settings per device: flag > env > device > profile > local.json > default
+	deviceSettings := make([]SyncSettings, len(devicesToSync))
+	for i, device := range devicesToSync {
+		settings, err := cfg.DeviceSettings(device)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s✗ Invalid settings for %s: %v%s\n", colorRed, device.RemotePath, err, colorReset)
+			os.Exit(exitConfig)
 		}
+		settings.Force = *force
+		settings.RetryFailed = *retryFailed
+		deviceSettings[i] = settings
 	}
 
 	totalDevices := len(devicesToSync)
+	baseURL := cfg.Settings().BaseURL
 
-	fmt.Printf("%s%sStarting sync of %d device(s) from %s%s\n", colorBold, colorCyan, totalDevices, remoteConfig.BaseURL, colorReset)
+	fmt.Printf("%s%sStarting sync of %d device(s) from %s%s\n", colorBold, colorCyan, totalDevices, baseURL, colorReset)
 	fmt.Println(separatorDouble())
+	emitEvent("run_start", "", runStartEvent{BaseURL: baseURL, Devices: totalDevices, RetryFailed: *retryFailed})
+
+	// From here on SIGINT and SIGTERM drain the run, then abort it, so the
+	// terminal is restored and the summary still printed.
+	ctl := newRunControl()
+	stopSignals := ctl.HandleSignals()
+	defer stopSignals()
+
+	// Planning phase: list and check every device before downloading
+	// anything, so progress and ETA cover only what is left to transfer,
+	// across the whole run. claims tracks the local paths planned so far, so
+	// that devices laid out into the same folder cannot overwrite each other
+	// even before the state records who owns what.
+	plans := make([]*devicePlan, totalDevices)
+	claims := make(map[string]string)
+	planErrs := make([]error, totalDevices)
+	var runBytes int64
+	planned := 0
+	for i, device := range devicesToSync {
+		name := fitInTerminal(device.RemotePath, 40)
+		plans[i], planErrs[i] = planSync(newQuickClient(), device, deviceSettings[i], state, failures, claims, ctl.Draining(), func(status string) {
+			statusLine("%s  Planning [%d/%d] %s: %s%s", colorDim, i+1, totalDevices, name, status, colorReset)
+		})
+		clearStatusLine()
+		if ctl.Stopped() {
+			fmt.Printf("%s⚠ Planning interrupted; nothing will be synced%s\n", colorYellow, colorReset)
+			break
+		}
+		planned++
+		if planErrs[i] != nil {
+			logger.Error("planning failed", planErrs[i], "device", device.RemotePath)
+			continue
+		}
+		plan := plans[i]
+		runBytes += plan.DownloadSize
+		emitEvent("scan_complete", device.RemotePath, scanCompleteEvent{
+			Files:         len(plan.Checks),
+			Bytes:         plan.TotalSize,
+			DownloadFiles: plan.DownloadCount,
+			DownloadBytes: plan.DownloadSize,
+			Collisions:    len(plan.Collisions),
+		})
+	}
+	fmt.Println(panelTopLabeled("PLAN"))
+	for _, row := range planSummaryRows(devicesToSync[:planned], plans[:planned], planErrs[:planned]) {
+		fmt.Println(panelLine(row))
+	}
+	fmt.Print(panelBottom())
+	fmt.Println()
+	for i, plan := range plans[:planned] {
+		if plan != nil && len(plan.Collisions) > 0 {
+			fmt.Printf("%s⚠ %s: %d file(s) skipped, their local paths collide%s\n", colorYellow, devicesToSync[i].RemotePath, len(plan.Collisions), colorReset)
+		}
+	}
+
+	// Preflight: check the whole plan against free disk space before the
+	// first download, so that no device starts that a full disk would stop.
+	shortfalls := freeSpaceShortfalls(plans[:planned], deviceSettings[:planned])
+	for i := range planned {
+		msg, short := shortfalls[i]
+		if !short {
+			continue
+		}
+		name := devicesToSync[i].RemotePath
+		if deviceSettings[i].Force {
+			fmt.Printf("%s⚠ %s: %s; continuing because of -force%s\n", colorYellow, name, msg, colorReset)
+			continue
+		}
+		fmt.Printf("%s✗ %s: %s (use -force to sync anyway)%s\n", colorRed, name, msg, colorReset)
+		planErrs[i] = errors.New(msg)
+		runBytes -= plans[i].DownloadSize
+	}
 
 	overallStart := time.Now()
 	var total SyncSummary
+	var reports []*deviceReport
+	var runBefore int64
 	devicesSynced := 0
 
+	action := "Syncing"
+	if *retryFailed {
+		action = "Retrying"
+	}
+	var dash *dashboard
+	if *tuiMode && !ctl.Stopped() {
+		if dash, err = startDashboard(devicesToSync, plans, action); err != nil {
+			fmt.Fprintf(os.Stderr, "%s⚠ Dashboard unavailable: %v%s\n", colorYellow, err, colorReset)
+		}
+	}
 	for i, device := range devicesToSync {
-		fmt.Printf("\n%s\n", devicePanel(i+1, totalDevices, device.RemotePath))
+		if ctl.Stopped() {
+			break
+		}
+		dash.DeviceStarted(i)
+		fmt.Printf("\n%s\n", devicePanel(i+1, totalDevices, action, device.RemotePath))
+		root, _ := layoutRoot(deviceSettings[i].Layout, device)
+		emitEvent("device_start", device.RemotePath, deviceStartEvent{Index: i + 1, Total: totalDevices, LocalDir: root})
 
-		drained, summary, err := syncDirectory(device, remoteConfig.BaseURL, maxConcurrent, errLog)
-		if err != nil {
-			localDir := filepath.Join(device.LocalPath, device.RemotePath)
-			errLog.Log("%s: error syncing: %v", localDir, err)
+		deviceLog := logger.With("device", device.RemotePath)
+		deviceLog.Info("device sync started", "path", root)
+
+		report := newDeviceReport(device, root)
+		var drained bool
+		var summary SyncSummary
+		if err = planErrs[i]; err != nil {
+			fmt.Printf("%s✗ %v%s\n", colorRed, err, colorReset)
+		} else {
+			run := runProgress{Device: i + 1, Devices: totalDevices, BytesBefore: runBefore, BytesTotal: runBytes}
+			drained, summary, err = syncDirectory(device, deviceSettings[i], plans[i], run, ctl, state, failures, deviceLog, report)
+			// Later devices continue from what was actually transferred,
+			// keeping their planned remainder.
+			runBytes += summary.BytesDownloaded - plans[i].DownloadSize
+			runBefore += summary.BytesDownloaded
+		}
+		report.finish(summary, drained, err)
+		reports = append(reports, report)
+		dash.DeviceFinished(i, report)
+		deviceEvent := deviceSummaryEvent{SyncSummary: summary, DurationMS: report.DurationMS, Drained: drained}
+		switch {
+		case errors.Is(err, errAborted):
+			deviceLog.Warn("sync aborted", nil, "path", root)
+			deviceEvent.Error = err.Error()
+		case err != nil:
+			deviceLog.Error("sync failed", err, "path", root)
+			deviceEvent.Error = err.Error()
 		}
+		deviceLog.Info("device sync finished",
+			"downloaded", summary.FilesDownloaded, "skipped", summary.FilesSkipped,
+			"deleted", summary.FilesDeleted, "errors", summary.FilesErrors, "cancelled", summary.FilesCancelled,
+			"bytes", summary.BytesDownloaded, "duration_ms", deviceEvent.DurationMS, "drained", drained)
+		emitEvent("device_summary", device.RemotePath, deviceEvent)
 		devicesSynced++
 		total.FilesDownloaded += summary.FilesDownloaded
 		total.FilesSkipped += summary.FilesSkipped
 		total.FilesDeleted += summary.FilesDeleted
 		total.FilesErrors += summary.FilesErrors
+		total.FilesCancelled += summary.FilesCancelled
 		total.BytesDownloaded += summary.BytesDownloaded
 		total.BytesSkipped += summary.BytesSkipped
 
 		fmt.Println(separatorSingle())
-		if drained {
-			break
+	}
+	dash.Close()
+
+	if *prune {
+		var pruned pruneResult
+		for i, device := range devicesToSync[:devicesSynced] {
+			pruneDevice(device, deviceSettings[i], stalePartAge, false, &pruned)
+		}
+		pruneLogs(cfg.Settings().LogRetention, logOpts.Dir, logger.Filename(), false, &pruned)
+		if pruned.Total() > 0 {
+			fmt.Printf("%s✓ Pruned %d empty dir(s), %d partial download(s), %d log(s)%s\n",
+				colorYellow, len(pruned.Dirs), len(pruned.Parts), len(pruned.Logs), colorReset)
 		}
 	}
 
@@ -109,12 +314,17 @@ func main() {
 
 	fmt.Println()
 	fmt.Println(panelTopLabeled("SUMMARY"))
-	fmt.Println(panelLine(fmt.Sprintf("%sFiles:%s    %s%d downloaded%s  %d skipped  %s%d deleted%s  %s%d errors%s",
+	cancelled := ""
+	if total.FilesCancelled > 0 {
+		cancelled = fmt.Sprintf("  %d cancelled", total.FilesCancelled)
+	}
+	fmt.Println(panelLine(fmt.Sprintf("%sFiles:%s    %s%d downloaded%s  %d skipped  %s%d deleted%s  %s%d errors%s%s",
 		colorBold, colorReset,
 		colorGreen, total.FilesDownloaded, colorReset,
 		total.FilesSkipped,
 		colorYellow, total.FilesDeleted, colorReset,
-		colorRed, total.FilesErrors, colorReset)))
+		colorRed, total.FilesErrors, colorReset,
+		cancelled)))
 	fmt.Println(panelLine(fmt.Sprintf("%sTransfer:%s %s%s downloaded%s  %s skipped  %s total",
 		colorBold, colorReset,
 		colorCyan, formatBytes(total.BytesDownloaded), colorReset,
@@ -124,16 +334,83 @@ func main() {
 		colorBold, colorReset, colorBlue, formatDuration(elapsed), colorReset)))
 	fmt.Println(panelLine(fmt.Sprintf("%sDevices:%s  %d synced",
 		colorBold, colorReset, devicesSynced)))
+	if len(reports) > 0 {
+		fmt.Println(panelLine(""))
+		for _, row := range deviceSummaryRows(reports) {
+			fmt.Println(panelLine(row))
+		}
+	}
 	fmt.Print(panelBottom())
 	fmt.Println()
 	fmt.Println()
 
 	// Display error summary
-	errorCount := errLog.Count()
-	if errorCount > 0 {
-		fmt.Printf("%s✓ Sync(s) completed with %d error(s)%s\n", colorYellow, errorCount, colorReset)
-		fmt.Printf("%s  See: %s%s\n", colorDim, errLog.Filename(), colorReset)
-	} else {
+	errorCount := logger.Count()
+	exitCode := runExitCode(ctl, reports, devicesSynced < totalDevices, errorCount > 0 || total.FilesErrors > 0)
+	runEvent := runSummaryEvent{SyncSummary: total, DevicesSynced: devicesSynced, DurationMS: elapsed.Milliseconds(), ExitCode: exitCode}
+	if logger.Written() {
+		runEvent.Log = logger.Filename()
+	}
+	emitEvent("run_summary", "", runEvent)
+
+	switch exitCode {
+	case exitAborted:
+		fmt.Printf("%s⚠ Sync(s) aborted%s\n", colorYellow, colorReset)
+	case exitDrained:
+		fmt.Printf("%s⚠ Sync(s) stopped early; the next run picks up the rest%s\n", colorYellow, colorReset)
+	case exitErrors:
+		fmt.Printf("%s✓ Sync(s) completed with %d error(s)%s\n", colorYellow, max(errorCount, total.FilesErrors), colorReset)
+	default:
 		fmt.Printf("%s✓ Sync(s) completed%s\n", colorGreen, colorReset)
 	}
+	if errorCount > 0 {
+		fmt.Printf("%s  See: %s%s\n", colorDim, logger.Filename(), colorReset)
+	} else if logger.Written() {
+		fmt.Printf("%s  Log: %s%s\n", colorDim, logger.Filename(), colorReset)
+	}
+
+	if *reportPath != "" {
+		report := &runReport{
+			Version:    version,
+			BaseURL:    baseURL,
+			Started:    overallStart,
+			DurationMS: elapsed.Milliseconds(),
+			Totals:     total,
+			Errors:     errorCount,
+			ExitCode:   exitCode,
+			Log:        runEvent.Log,
+			Devices:    reports,
+		}
+		if err := writeReport(*reportPath, report); err != nil {
+			fmt.Fprintf(os.Stderr, "%s✗ Error writing report: %v%s\n", colorRed, err, colorReset)
+		} else {
+			fmt.Printf("%s✓ Report written to %s%s\n", colorGreen, *reportPath, colorReset)
+		}
+	}
+
+	logger.Close() // os.Exit skips deferred calls
+	os.Exit(exitCode)
+}
+
+// runExitCode picks the exit code of a sync run: aborted beats drained,
+// which beats completed with errors.
+func runExitCode(ctl *runControl, reports []*deviceReport, unsynced, failed bool) int {
+	drained := unsynced
+	for _, report := range reports {
+		switch report.Status {
+		case deviceStatusAborted:
+			return exitAborted
+		case deviceStatusDrained:
+			drained = true
+		}
+	}
+	switch {
+	case ctl.Aborted():
+		return exitAborted
+	case drained:
+		return exitDrained
+	case failed:
+		return exitErrors
+	}
+	return exitOK
 }
@@ -0,0 +1,39 @@
+package main
+
+import "testing"
+
+func TestRunExitCode(t *testing.T) {
+	reports := func(statuses ...string) []*deviceReport {
+		var list []*deviceReport
+		for _, status := range statuses {
+			list = append(list, &deviceReport{Status: status})
+		}
+		return list
+	}
+	tests := []struct {
+		name     string
+		aborted  bool
+		reports  []*deviceReport
+		unsynced bool
+		failed   bool
+		want     int
+	}{
+		{"all ok", false, reports(deviceStatusOK, deviceStatusOK), false, false, exitOK},
+		{"no devices", false, nil, false, false, exitOK},
+		{"errors", false, reports(deviceStatusOK, deviceStatusErrors), false, true, exitErrors},
+		{"device failed", false, reports(deviceStatusFailed), false, true, exitErrors},
+		{"drained", false, reports(deviceStatusOK, deviceStatusDrained), false, true, exitDrained},
+		{"devices left unsynced", false, reports(deviceStatusOK), true, false, exitDrained},
+		{"aborted device", false, reports(deviceStatusDrained, deviceStatusAborted), false, true, exitAborted},
+		{"aborted run", true, reports(deviceStatusOK), true, false, exitAborted},
+	}
+	for _, tt := range tests {
+		ctl := newRunControl()
+		if tt.aborted {
+			ctl.Abort()
+		}
+		if got := runExitCode(ctl, tt.reports, tt.unsynced, tt.failed); got != tt.want {
+			t.Errorf("%s: runExitCode = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
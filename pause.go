@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+// pauseGate lets the pause hotkey hold all downloads of a device. While it
+// is paused, downloads stop reading from their response bodies. A nil
+// *pauseGate never pauses.
+type pauseGate struct {
+	mu      sync.Mutex
+	resumed chan struct{} // closed while not paused
+}
+
+func newPauseGate() *pauseGate {
+	resumed := make(chan struct{})
+	close(resumed)
+	return &pauseGate{resumed: resumed}
+}
+
+// Toggle pauses a running gate or resumes a paused one, and reports whether
+// the gate is now paused.
+func (g *pauseGate) Toggle() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	select {
+	case <-g.resumed:
+		g.resumed = make(chan struct{})
+		return true
+	default:
+		close(g.resumed)
+		return false
+	}
+}
+
+// Paused reports whether the gate is paused.
+func (g *pauseGate) Paused() bool {
+	if g == nil {
+		return false
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	select {
+	case <-g.resumed:
+		return false
+	default:
+		return true
+	}
+}
+
+// Wait blocks while the gate is paused. It returns ctx's error if ctx is
+// done first.
+func (g *pauseGate) Wait(ctx context.Context) error {
+	if g == nil {
+		return nil
+	}
+	g.mu.Lock()
+	resumed := g.resumed
+	g.mu.Unlock()
+	select {
+	case <-resumed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
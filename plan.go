@@ -0,0 +1,281 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// devicePlan is what syncing a device involves, worked out from the remote
+// listing before anything is downloaded or deleted.
+type devicePlan struct {
+	RemoteURL  string
+	LocalDir   string          // root under which the layout places the device's files
+	Exclusive  bool            // LocalDir belongs to this device alone
+	Tasks      []syncTask      // files to check and download if needed
+	Wanted     map[string]bool // local paths that belong to the remote listing
+	Collisions []string        // files skipped because their local path is taken
+	TotalSize  int64           // listed size of all tasks
+
+	// Set by Check.
+	Checks        []taskCheck // one per task, in task order
+	DownloadCount int         // tasks that need downloading
+	DownloadSize  int64       // bytes still to download
+}
+
+// taskCheck is the planning phase's verdict on one task.
+type taskCheck struct {
+	syncTask
+	Download bool          // the local copy is missing or differs from the remote
+	Partial  int64         // bytes of a partial download that will be resumed
+	Elapsed  time.Duration // how long the check took
+	Err      error         // the check failed; the task is neither downloaded nor skipped
+}
+
+// Bytes returns how much the task still has to download.
+func (c taskCheck) Bytes() int64 {
+	if !c.Download {
+		return 0
+	}
+	return max(c.Size-c.Partial, 0)
+}
+
+// planDevice lists a device's remote directory tree and maps every file to
+// its local path. Files rejected by the filter stay in the wanted set so that
+// existing local copies are left alone rather than deleted. A local path
+// claimed by two remote files, owned by another device, or already in claims
+// for another device planned earlier in the run, is a collision: the file is
+// skipped rather than overwritten. Accepted paths are added to claims (local
+// path → device key) unless it is nil.
+func planDevice(client *http.Client, device Device, settings SyncSettings, state *SyncState, claims map[string]string, onDir func(string)) (*devicePlan, error) {
+	remoteURL := settings.BaseURL + device.RemotePath
+	filesInfo, err := getDirectoryListing(client, remoteURL, onDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get directory listing: %w", err)
+	}
+
+	localDir, exclusive := layoutRoot(settings.Layout, device)
+	plan := &devicePlan{
+		RemoteURL: remoteURL,
+		LocalDir:  localDir,
+		Exclusive: exclusive,
+		Wanted:    make(map[string]bool),
+	}
+
+	// getDirectoryListing already excludes systeminfo.txt and directories.
+	claimed := make(map[string]string) // local path → remote relative path
+	key := deviceKey(device)
+	for _, fileInfo := range filesInfo {
+		localFile := layoutFilePath(settings.Layout, device, fileInfo)
+		if other, ok := claimed[localFile]; ok {
+			plan.Collisions = append(plan.Collisions, fmt.Sprintf("%s and %s both map to %s", other, fileInfo.RelPath(), localFile))
+			continue
+		}
+		if owner, ok := state.Owner(localFile); ok && owner != key {
+			plan.Collisions = append(plan.Collisions, fmt.Sprintf("%s is already owned by %s", localFile, owner))
+			continue
+		}
+		if owner, ok := claims[localFile]; ok && owner != key {
+			plan.Collisions = append(plan.Collisions, fmt.Sprintf("%s is also planned for %s", localFile, owner))
+			continue
+		}
+		claimed[localFile] = fileInfo.RelPath()
+		if claims != nil {
+			claims[localFile] = key
+		}
+		plan.Wanted[localFile] = true
+		if !settings.Filter.Allows(fileInfo.Name) {
+			continue
+		}
+		plan.Tasks = append(plan.Tasks, syncTask{FileInfo: fileInfo, LocalPath: localFile})
+		plan.TotalSize += fileInfo.Size
+	}
+
+	return plan, nil
+}
+
+// Check decides for every task whether it needs downloading, with the same
+// checks a download would make (shouldDownload), up to maxConcurrent at a
+// time. Files flagged by verify are downloaded without checking. Where the
+// remote was asked, the task's size becomes the exact remote size. onCheck
+// is called after each check with the number done so far. Once stop is
+// closed no further checks start and the plan is left incomplete.
+func (p *devicePlan) Check(client *http.Client, state *SyncState, maxConcurrent int, stop <-chan struct{}, onCheck func(done, total int)) {
+	p.Checks = make([]taskCheck, len(p.Tasks))
+	var (
+		mu   sync.Mutex
+		wg   sync.WaitGroup
+		done int
+	)
+	sem := make(chan struct{}, maxConcurrent)
+dispatch:
+	for i, task := range p.Tasks {
+		select {
+		case sem <- struct{}{}:
+		case <-stop:
+			break dispatch
+		}
+		wg.Add(1)
+		go func(i int, task syncTask) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			check := taskCheck{syncTask: task}
+			start := time.Now()
+			if state.Requeued(task.LocalPath) {
+				check.Download = true
+			} else {
+				var remoteSize int64
+				check.Download, remoteSize, check.Err = shouldDownload(client, remoteFileURL(p.RemoteURL, task.FileInfo), task.LocalPath)
+				if remoteSize >= 0 {
+					check.Size = remoteSize
+				}
+			}
+			check.Elapsed = time.Since(start)
+			if check.Download {
+				if info, err := os.Stat(task.LocalPath + partSuffix); err == nil {
+					check.Partial = info.Size()
+				}
+			}
+			p.Checks[i] = check
+
+			mu.Lock()
+			defer mu.Unlock()
+			done++
+			if onCheck != nil {
+				onCheck(done, len(p.Tasks))
+			}
+		}(i, task)
+	}
+	wg.Wait()
+
+	for _, check := range p.Checks {
+		if check.Download {
+			p.DownloadCount++
+			p.DownloadSize += check.Bytes()
+		}
+	}
+}
+
+// planSync works out what syncing a device involves before anything is
+// downloaded: its remote listing (or, when retrying, exactly the recorded
+// failures) and a check of every file. onStatus receives progress messages
+// such as "scanning <dir>" or "checking 12/40". claims holds the local paths
+// of the devices planned before this one (see planDevice). Closing stop cuts
+// the checks short; the caller must not sync such a plan.
+func planSync(client *http.Client, device Device, settings SyncSettings, state *SyncState, failures *FailureLog, claims map[string]string, stop <-chan struct{}, onStatus func(string)) (*devicePlan, error) {
+	var plan *devicePlan
+	if settings.RetryFailed {
+		plan = retryPlan(device, settings, failures.ForDevice(device))
+	} else {
+		onStatus("scanning")
+		var err error
+		plan, err = planDevice(client, device, settings, state, claims, func(subDir string) {
+			label := "root"
+			if subDir != "" {
+				label = subDir
+			}
+			onStatus("scanning " + label)
+		})
+		if err != nil {
+			return nil, err
+		}
+		failures.Prune(device, plan.Wanted)
+	}
+
+	plan.Check(client, state, settings.MaxConcurrent, stop, func(done, total int) {
+		onStatus(fmt.Sprintf("checking %d/%d", done, total))
+	})
+	return plan, nil
+}
+
+// planSummaryRows renders the planning phase's result as table rows for the
+// PLAN panel, header first and a total last: per device the files checked,
+// how many need downloading and the bytes left to transfer. A device whose
+// planning failed shows its error instead.
+func planSummaryRows(devices []Device, plans []*devicePlan, errs []error) []string {
+	const numCols = 1 + 8 + 1 + 8 + 1 + 11 // Files, Get and Bytes with separators
+	nameCols := max(terminalWidth()-4-numCols-1, 1)
+	row := func(name string, files, count int, size int64) string {
+		return padRunes(truncateRunes(name, nameCols), nameCols) +
+			fmt.Sprintf(" %8d %8d %11s", files, count, formatBytes(size))
+	}
+
+	rows := []string{colorBold + padRunes("Device", nameCols) + fmt.Sprintf(" %8s %8s %11s", "Files", "Get", "Bytes") + colorReset}
+	var files, count int
+	var size int64
+	for i, device := range devices {
+		name := strings.TrimSuffix(device.RemotePath, "/")
+		if errs[i] != nil {
+			line := padRunes(truncateRunes(name, nameCols), nameCols) + " " + truncateRunes(errs[i].Error(), numCols-1)
+			rows = append(rows, colorRed+line+colorReset)
+			continue
+		}
+		plan := plans[i]
+		rows = append(rows, row(name, len(plan.Checks), plan.DownloadCount, plan.DownloadSize))
+		files += len(plan.Checks)
+		count += plan.DownloadCount
+		size += plan.DownloadSize
+	}
+	if len(devices) > 1 {
+		rows = append(rows, colorBold+row("Total", files, count, size)+colorReset)
+	}
+	return rows
+}
+
+// ObsoleteFiles returns the local files cleanup would delete. Files the
+// state records as owned by this device are always candidates. When the
+// device's local root is exclusive to it, any other file inside the root is
+// a candidate too, which also covers files synced before state was recorded.
+func (p *devicePlan) ObsoleteFiles(device Device, state *SyncState) ([]string, error) {
+	var obsolete []string
+	seen := make(map[string]bool)
+	for _, path := range state.OwnedFiles(device) {
+		if !p.Wanted[path] {
+			obsolete = append(obsolete, path)
+			seen[path] = true
+		}
+	}
+	if !p.Exclusive {
+		return obsolete, nil
+	}
+
+	key := deviceKey(device)
+	err := filepath.Walk(p.LocalDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil // skip inaccessible paths
+		}
+		if info.IsDir() {
+			return nil
+		}
+		if info.Name() == "systeminfo.txt" || p.Wanted[path] || seen[path] {
+			return nil
+		}
+		if strings.HasSuffix(path, partSuffix) {
+			return nil // partial download: resumed by the next sync or removed by prune
+		}
+		if owner, ok := state.Owner(path); ok && owner != key {
+			return nil // belongs to another device sharing this directory
+		}
+		obsolete = append(obsolete, path)
+		return nil
+	})
+	return obsolete, err
+}
+
+// remoteFileURL builds a file's URL under remoteURL, re-encoding each SubDir
+// segment and the filename.
+func remoteFileURL(remoteURL string, file FileInfo) string {
+	var escapedSubDir strings.Builder
+	for seg := range strings.SplitSeq(file.SubDir, "/") {
+		if seg != "" {
+			escapedSubDir.WriteString(url.PathEscape(seg) + "/")
+		}
+	}
+	return remoteURL + escapedSubDir.String() + url.PathEscape(file.Name)
+}
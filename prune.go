@@ -0,0 +1,174 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	defaultLogRetention = 30                 // days
+	stalePartAge        = 7 * 24 * time.Hour // partial downloads older than this are not resumed
+)
+
+// logGlobs match the log files prune removes: current logs with their
+// rotated backups, and error logs written by older versions.
+var logGlobs = []string{"myrientor_*.log", "myrientor_*.log.*", "myrientor-errors_*.log"}
+
+// pruneResult collects what a prune removed, or would remove on a dry run.
+type pruneResult struct {
+	Dirs  []string // empty directories
+	Parts []string // stale partial downloads
+	Logs  []string // expired logs
+	Bytes int64    // size of removed files
+}
+
+// Total is the number of removed entries.
+func (r *pruneResult) Total() int {
+	return len(r.Dirs) + len(r.Parts) + len(r.Logs)
+}
+
+// runPruneCommand implements `myrientor prune [device…]`: remove empty
+// directories under device roots, stale partial downloads, and logs
+// older than log_retention days.
+func runPruneCommand(args []string) int {
+	fs := flag.NewFlagSet("prune", flag.ExitOnError)
+	flags := registerFlags(fs)
+	dryRun := fs.Bool("dry-run", false, "List what would be removed without removing it")
+	partAge := fs.Duration("part-age", stalePartAge, "Remove partial downloads not modified for this long")
+	fs.Parse(args)
+
+	cfg, err := loadConfig(flags)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s✗ Config error: %v%s\n", colorRed, err, colorReset)
+		return exitConfig
+	}
+	devices, err := cfg.MatchDevices(fs.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s✗ %v%s\n", colorRed, err, colorReset)
+		return exitConfig
+	}
+
+	var result pruneResult
+	for _, device := range devices {
+		deviceSettings, err := cfg.DeviceSettings(device)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s✗ Invalid settings for %s: %v%s\n", colorRed, device.RemotePath, err, colorReset)
+			return exitConfig
+		}
+		pruneDevice(device, deviceSettings, *partAge, *dryRun, &result)
+	}
+	pruneLogs(cfg.Settings().LogRetention, cfg.Settings().LogDir, "", *dryRun, &result)
+
+	verb := "Removed"
+	if *dryRun {
+		verb = "Would remove"
+	}
+	for _, group := range []struct {
+		name  string
+		paths []string
+	}{
+		{"empty directories", result.Dirs},
+		{"partial downloads", result.Parts},
+		{"logs", result.Logs},
+	} {
+		if len(group.paths) == 0 {
+			continue
+		}
+		fmt.Printf("\n  %s%s %d %s%s\n", colorYellow, verb, len(group.paths), group.name, colorReset)
+		for _, path := range group.paths {
+			fmt.Printf("    %s\n", path)
+		}
+	}
+
+	fmt.Println()
+	fmt.Println(panelTopLabeled("PRUNE"))
+	fmt.Println(panelLine(fmt.Sprintf("%s%s:%s %d empty dir(s)  %d partial download(s)  %d log(s)  %s%s%s",
+		colorBold, verb, colorReset,
+		len(result.Dirs), len(result.Parts), len(result.Logs),
+		colorCyan, formatBytes(result.Bytes), colorReset)))
+	fmt.Println(panelBottom())
+	return exitOK
+}
+
+// pruneDevice removes partial downloads older than partAge under the
+// device's local root and, if the root belongs to this device alone, every
+// empty directory below it. The root itself is kept. Empty directories in a
+// shared root may be the user's own and are left alone.
+func pruneDevice(device Device, settings SyncSettings, partAge time.Duration, dryRun bool, result *pruneResult) {
+	root, exclusive := layoutRoot(settings.Layout, device)
+	if _, err := os.Stat(root); err != nil {
+		return
+	}
+
+	removed := make(map[string]bool)
+	var dirs []string
+	filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info.IsDir() {
+			if path != root {
+				dirs = append(dirs, path)
+			}
+			return nil
+		}
+		if strings.HasSuffix(path, partSuffix) && time.Since(info.ModTime()) > partAge {
+			if dryRun || os.Remove(path) == nil {
+				removed[path] = true
+				result.Parts = append(result.Parts, path)
+				result.Bytes += info.Size()
+			}
+		}
+		return nil
+	})
+	if !exclusive {
+		return
+	}
+
+	// Children sort after their parents, so walking backwards empties
+	// nested directories before their parents are checked.
+	sort.Strings(dirs)
+	for i := len(dirs) - 1; i >= 0; i-- {
+		entries, err := os.ReadDir(dirs[i])
+		if err != nil {
+			continue
+		}
+		empty := true
+		for _, entry := range entries {
+			if !removed[filepath.Join(dirs[i], entry.Name())] {
+				empty = false
+				break
+			}
+		}
+		if empty && (dryRun || os.Remove(dirs[i]) == nil) {
+			removed[dirs[i]] = true
+			result.Dirs = append(result.Dirs, dirs[i])
+		}
+	}
+}
+
+// pruneLogs removes logs in dir (the working directory if empty) last
+// written more than retentionDays ago, except keep (the current run's log).
+func pruneLogs(retentionDays int, dir, keep string, dryRun bool, result *pruneResult) {
+	retention := time.Duration(retentionDays) * 24 * time.Hour
+	var logs []string
+	for _, pattern := range logGlobs {
+		matches, _ := filepath.Glob(filepath.Join(dir, pattern))
+		logs = append(logs, matches...)
+	}
+	for _, path := range logs {
+		info, err := os.Stat(path)
+		if err != nil || path == keep || time.Since(info.ModTime()) <= retention {
+			continue
+		}
+		if dryRun || os.Remove(path) == nil {
+			result.Logs = append(result.Logs, path)
+			result.Bytes += info.Size()
+		}
+	}
+}
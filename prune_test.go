@@ -0,0 +1,92 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPruneDevice(t *testing.T) {
+	tests := []struct {
+		name      string
+		layout    string
+		dryRun    bool
+		wantDirs  []string // relative to the device root, in removal order
+		wantParts []string
+		wantKept  []string
+	}{
+		{
+			name:      "exclusive root",
+			layout:    defaultLayout,
+			wantDirs:  []string{"stale", "a/b/c", "a/b", "a"},
+			wantParts: []string{"stale/Old.zip" + partSuffix},
+			wantKept:  []string{"keep/Tetris.zip", "keep/New.zip" + partSuffix},
+		},
+		{
+			name:      "dry run",
+			layout:    defaultLayout,
+			dryRun:    true,
+			wantDirs:  []string{"stale", "a/b/c", "a/b", "a"},
+			wantParts: []string{"stale/Old.zip" + partSuffix},
+			wantKept:  []string{"a/b/c", "stale/Old.zip" + partSuffix},
+		},
+		{
+			name:      "shared root keeps directories",
+			layout:    "{local_path}/{subdir}/{name}",
+			wantParts: []string{"stale/Old.zip" + partSuffix},
+			wantKept:  []string{"a/b/c", "stale"},
+		},
+	}
+	for _, tt := range tests {
+		device := Device{RemotePath: "Nintendo/", LocalPath: t.TempDir()}
+		root, _ := layoutRoot(tt.layout, device)
+		for _, dir := range []string{"a/b/c", "keep", "stale"} {
+			if err := os.MkdirAll(filepath.Join(root, dir), 0o755); err != nil {
+				t.Fatal(err)
+			}
+		}
+		old := time.Now().Add(-2 * stalePartAge)
+		for _, file := range []struct {
+			path    string
+			modTime time.Time
+		}{
+			{"keep/Tetris.zip", old},
+			{"keep/New.zip" + partSuffix, time.Now()},
+			{"stale/Old.zip" + partSuffix, old},
+		} {
+			path := filepath.Join(root, file.path)
+			if err := os.WriteFile(path, []byte("data"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			os.Chtimes(path, file.modTime, file.modTime)
+		}
+
+		var result pruneResult
+		pruneDevice(device, SyncSettings{Layout: tt.layout}, stalePartAge, tt.dryRun, &result)
+
+		if got, want := result.Dirs, rootPaths(root, tt.wantDirs); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: Dirs = %q, want %q", tt.name, got, want)
+		}
+		if got, want := result.Parts, rootPaths(root, tt.wantParts); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: Parts = %q, want %q", tt.name, got, want)
+		}
+		for _, path := range rootPaths(root, tt.wantKept) {
+			if _, err := os.Stat(path); err != nil {
+				t.Errorf("%s: %s was removed", tt.name, path)
+			}
+		}
+		if _, err := os.Stat(root); err != nil {
+			t.Errorf("%s: device root was removed", tt.name)
+		}
+	}
+}
+
+func rootPaths(root string, paths []string) []string {
+	var joined []string
+	for _, path := range paths {
+		joined = append(joined, filepath.Join(root, filepath.FromSlash(path)))
+	}
+	return joined
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// rateLimiter is a token bucket shared by all downloads of a device so that
+// their combined throughput stays under a bandwidth cap. A nil *rateLimiter
+// imposes no limit.
+type rateLimiter struct {
+	mu        sync.Mutex
+	rate      float64 // bytes per second
+	allowance float64 // bytes that may be transferred right now; negative means debt
+	last      time.Time
+}
+
+// newRateLimiter returns a limiter for bytesPerSec, or nil if unlimited.
+func newRateLimiter(bytesPerSec int64) *rateLimiter {
+	if bytesPerSec <= 0 {
+		return nil
+	}
+	return &rateLimiter{
+		rate:      float64(bytesPerSec),
+		allowance: float64(bytesPerSec),
+		last:      time.Now(),
+	}
+}
+
+// Wait accounts for n transferred bytes and sleeps long enough to keep the
+// average rate under the cap. Bursts of up to one second are allowed. If ctx
+// is cancelled meanwhile, Wait returns its cause at once.
+func (l *rateLimiter) Wait(ctx context.Context, n int) error {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	l.allowance += now.Sub(l.last).Seconds() * l.rate
+	l.last = now
+	if l.allowance > l.rate {
+		l.allowance = l.rate
+	}
+	l.allowance -= float64(n)
+	var delay time.Duration
+	if l.allowance < 0 {
+		delay = time.Duration(-l.allowance / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return context.Cause(ctx)
+	}
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// plainProgressInterval is how often the plain reporter prints a progress
+// summary line.
+const plainProgressInterval = 30 * time.Second
+
+// syncReporter renders the progress of one device sync. The live reporter
+// redraws the activity lines and stats panel in place; the dashboard
+// reporter feeds the -tui dashboard; the plain reporter
+// writes one line per finished file and a periodic progress summary, which
+// suits pipes, cron and log files; the JSON reporter feeds the event stream.
+type syncReporter interface {
+	Start(stats *SyncStats) // downloads are about to start
+	FileChecked(relPath string, needsDownload bool, elapsed time.Duration)
+	FileSkipped(relPath string, bytes int64)
+	FileDownloaded(relPath string, bytes int64, elapsed time.Duration)
+	FileFailed(relPath string, err error)
+	FileCancelled(relPath string) // skipped with the skip hotkey
+	FileDeleted(path string)
+	Stop(stats *SyncStats) // all downloads have finished; render final stats
+}
+
+// newSyncReporter returns the reporter for the current output mode.
+func newSyncReporter(device Device) syncReporter {
+	switch {
+	case events != nil:
+		return &jsonReporter{device: device.RemotePath}
+	case plainOutput:
+		return &plainReporter{}
+	case tui != nil:
+		return tui.reporter()
+	}
+	return &liveReporter{}
+}
+
+// liveReporter redraws SyncStats every 100ms. Per-file progress is shown
+// through the activity slots, so file events need no output of their own.
+type liveReporter struct {
+	stop chan struct{}
+	done chan struct{}
+}
+
+func (r *liveReporter) Start(stats *SyncStats) {
+	// Print initial empty lines for activities and stats
+	initialLines := stats.activeSlots + 6
+	for range initialLines {
+		fmt.Println()
+	}
+	stats.lastPrintedLines = initialLines
+
+	r.stop = make(chan struct{})
+	r.done = make(chan struct{})
+	go func() {
+		defer close(r.done)
+		ticker := time.NewTicker(100 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				stats.Print()
+			case <-r.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (r *liveReporter) FileChecked(string, bool, time.Duration)     {}
+func (r *liveReporter) FileSkipped(string, int64)                   {}
+func (r *liveReporter) FileDownloaded(string, int64, time.Duration) {}
+func (r *liveReporter) FileFailed(string, error)                    {}
+func (r *liveReporter) FileCancelled(string)                        {}
+func (r *liveReporter) FileDeleted(string)                          {}
+
+func (r *liveReporter) Stop(stats *SyncStats) {
+	close(r.stop)
+	<-r.done
+	stats.Print()
+}
+
+// plainReporter writes one line per event, never moving the cursor.
+type plainReporter struct {
+	mu   sync.Mutex // keeps lines from concurrent downloads whole
+	stop chan struct{}
+	done chan struct{}
+}
+
+func (r *plainReporter) println(format string, args ...any) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	fmt.Printf(format+"\n", args...)
+}
+
+func (r *plainReporter) Start(stats *SyncStats) {
+	r.println("  %s", stats.ProgressLine())
+
+	r.stop = make(chan struct{})
+	r.done = make(chan struct{})
+	go func() {
+		defer close(r.done)
+		ticker := time.NewTicker(plainProgressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				r.println("  %s", stats.ProgressLine())
+			case <-r.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (r *plainReporter) FileChecked(string, bool, time.Duration) {}
+func (r *plainReporter) FileSkipped(string, int64)               {}
+
+func (r *plainReporter) FileDownloaded(relPath string, bytes int64, _ time.Duration) {
+	r.println("  ✓ %s (%s)", relPath, formatBytes(bytes))
+}
+
+func (r *plainReporter) FileFailed(relPath string, err error) {
+	r.println("  ✗ %s: %v", relPath, err)
+}
+
+func (r *plainReporter) FileCancelled(relPath string) {
+	r.println("  ⚠ %s: %v", relPath, errSkipped)
+}
+
+func (r *plainReporter) FileDeleted(path string) {
+	r.println("  - %s", path)
+}
+
+func (r *plainReporter) Stop(stats *SyncStats) {
+	close(r.stop)
+	<-r.done
+	r.println("  %s", stats.ProgressLine())
+}
+
+// jsonReporter emits an event per file and a progress event every
+// eventProgressInterval.
+type jsonReporter struct {
+	device string
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+func (r *jsonReporter) Start(stats *SyncStats) {
+	emitEvent("progress", r.device, stats.Progress())
+
+	r.stop = make(chan struct{})
+	r.done = make(chan struct{})
+	go func() {
+		defer close(r.done)
+		ticker := time.NewTicker(eventProgressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				emitEvent("progress", r.device, stats.Progress())
+			case <-r.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (r *jsonReporter) FileChecked(relPath string, needsDownload bool, elapsed time.Duration) {
+	emitEvent("file_checked", r.device, fileCheckedEvent{File: relPath, NeedsDownload: needsDownload, DurationMS: elapsed.Milliseconds()})
+}
+
+func (r *jsonReporter) FileSkipped(relPath string, bytes int64) {
+	emitEvent("file_skipped", r.device, fileSkippedEvent{File: relPath, Bytes: bytes})
+}
+
+func (r *jsonReporter) FileDownloaded(relPath string, bytes int64, elapsed time.Duration) {
+	emitEvent("file_downloaded", r.device, fileDownloadedEvent{File: relPath, Bytes: bytes, DurationMS: elapsed.Milliseconds()})
+}
+
+func (r *jsonReporter) FileFailed(relPath string, err error) {
+	emitEvent("file_failed", r.device, fileFailedEvent{File: relPath, Class: classifyError(err), Error: err.Error()})
+}
+
+func (r *jsonReporter) FileCancelled(relPath string) {
+	emitEvent("file_cancelled", r.device, fileCancelledEvent{File: relPath})
+}
+
+func (r *jsonReporter) FileDeleted(path string) {
+	emitEvent("file_deleted", r.device, fileDeletedEvent{Path: path})
+}
+
+func (r *jsonReporter) Stop(stats *SyncStats) {
+	close(r.stop)
+	<-r.done
+	emitEvent("progress", r.device, stats.Progress())
+}
+
+// teeReporter passes every event to each of its reporters.
+type teeReporter []syncReporter
+
+func (t teeReporter) Start(stats *SyncStats) {
+	for _, r := range t {
+		r.Start(stats)
+	}
+}
+
+func (t teeReporter) FileChecked(relPath string, needsDownload bool, elapsed time.Duration) {
+	for _, r := range t {
+		r.FileChecked(relPath, needsDownload, elapsed)
+	}
+}
+
+func (t teeReporter) FileSkipped(relPath string, bytes int64) {
+	for _, r := range t {
+		r.FileSkipped(relPath, bytes)
+	}
+}
+
+func (t teeReporter) FileDownloaded(relPath string, bytes int64, elapsed time.Duration) {
+	for _, r := range t {
+		r.FileDownloaded(relPath, bytes, elapsed)
+	}
+}
+
+func (t teeReporter) FileFailed(relPath string, err error) {
+	for _, r := range t {
+		r.FileFailed(relPath, err)
+	}
+}
+
+func (t teeReporter) FileCancelled(relPath string) {
+	for _, r := range t {
+		r.FileCancelled(relPath)
+	}
+}
+
+func (t teeReporter) FileDeleted(path string) {
+	for _, r := range t {
+		r.FileDeleted(path)
+	}
+}
+
+func (t teeReporter) Stop(stats *SyncStats) {
+	for _, r := range t {
+		r.Stop(stats)
+	}
+}
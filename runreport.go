@@ -0,0 +1,372 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Device outcomes shown in reports and the summary panel.
+const (
+	deviceStatusOK      = "ok"
+	deviceStatusErrors  = "errors"  // synced, but some files failed
+	deviceStatusDrained = "drained" // stopped early by q, a signal or low disk space
+	deviceStatusFailed  = "failed"  // the device could not be synced at all
+	deviceStatusAborted = "aborted" // stopped by the abort hotkey or a second signal
+)
+
+// reportFile is a downloaded or deleted file in a run report.
+type reportFile struct {
+	Path       string `json:"path"`
+	Bytes      int64  `json:"bytes,omitempty"`
+	DurationMS int64  `json:"duration_ms,omitempty"`
+}
+
+// reportFailure is a file that failed to check or download.
+type reportFailure struct {
+	Path  string `json:"path"`
+	Class string `json:"class"`
+	Error string `json:"error"`
+}
+
+// deviceReport is the outcome of syncing one device. It collects the
+// downloaded, deleted and failed files as a syncReporter.
+type deviceReport struct {
+	mu sync.Mutex
+
+	Device         string          `json:"device"`
+	LocalDir       string          `json:"local_dir"`
+	Started        time.Time       `json:"started"`
+	DurationMS     int64           `json:"duration_ms"`
+	Status         string          `json:"status"`
+	Error          string          `json:"error,omitempty"`
+	Summary        SyncSummary     `json:"summary"`
+	BytesPerSecond int64           `json:"bytes_per_second"` // average over the device's sync
+	Downloaded     []reportFile    `json:"downloaded"`
+	Deleted        []reportFile    `json:"deleted"`
+	Failed         []reportFailure `json:"failed"`
+}
+
+func newDeviceReport(device Device, localDir string) *deviceReport {
+	return &deviceReport{
+		Device:     device.RemotePath,
+		LocalDir:   localDir,
+		Started:    time.Now(),
+		Downloaded: []reportFile{},
+		Deleted:    []reportFile{},
+		Failed:     []reportFailure{},
+	}
+}
+
+// finish records the result returned by syncDirectory.
+func (r *deviceReport) finish(summary SyncSummary, drained bool, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	elapsed := time.Since(r.Started)
+	r.DurationMS = elapsed.Milliseconds()
+	r.Summary = summary
+	if elapsed > 0 {
+		r.BytesPerSecond = int64(float64(summary.BytesDownloaded) / elapsed.Seconds())
+	}
+	switch {
+	case errors.Is(err, errAborted):
+		r.Status = deviceStatusAborted
+	case err != nil:
+		r.Status = deviceStatusFailed
+		r.Error = err.Error()
+	case drained:
+		r.Status = deviceStatusDrained
+	case summary.FilesErrors > 0:
+		r.Status = deviceStatusErrors
+	default:
+		r.Status = deviceStatusOK
+	}
+}
+
+func (r *deviceReport) Start(*SyncStats)                        {}
+func (r *deviceReport) FileChecked(string, bool, time.Duration) {}
+func (r *deviceReport) FileSkipped(string, int64)               {}
+func (r *deviceReport) FileCancelled(string)                    {}
+func (r *deviceReport) Stop(*SyncStats)                         {}
+
+func (r *deviceReport) FileDownloaded(relPath string, bytes int64, elapsed time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Downloaded = append(r.Downloaded, reportFile{Path: relPath, Bytes: bytes, DurationMS: elapsed.Milliseconds()})
+}
+
+func (r *deviceReport) FileFailed(relPath string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Failed = append(r.Failed, reportFailure{Path: relPath, Class: classifyError(err), Error: err.Error()})
+}
+
+func (r *deviceReport) FileDeleted(path string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Deleted = append(r.Deleted, reportFile{Path: path})
+}
+
+// statusColor returns the color a device status is shown in.
+func statusColor(status string) string {
+	switch status {
+	case deviceStatusOK:
+		return colorGreen
+	case deviceStatusFailed:
+		return colorRed
+	}
+	return colorYellow
+}
+
+// summaryColumn is a right-aligned numeric column of the per-device table.
+type summaryColumn struct {
+	title string
+	width int
+	value func(r *deviceReport) string
+}
+
+// deviceSummaryRows renders reports as table rows for the SUMMARY panel,
+// header first. The device column takes whatever width is left; on narrow
+// terminals the duration and then the bytes column are dropped before the
+// device names get shorter than minDeviceCols.
+func deviceSummaryRows(reports []*deviceReport) []string {
+	const (
+		minDeviceCols = 12
+		statusCols    = 8 // widest status plus a space before the border
+	)
+	columns := []summaryColumn{
+		{"Down", 6, func(r *deviceReport) string { return fmt.Sprint(r.Summary.FilesDownloaded) }},
+		{"Skip", 6, func(r *deviceReport) string { return fmt.Sprint(r.Summary.FilesSkipped) }},
+		{"Del", 5, func(r *deviceReport) string { return fmt.Sprint(r.Summary.FilesDeleted) }},
+		{"Err", 5, func(r *deviceReport) string { return fmt.Sprint(r.Summary.FilesErrors) }},
+		{"Bytes", 11, func(r *deviceReport) string { return formatBytes(r.Summary.BytesDownloaded) }},
+		{"Time", 10, func(r *deviceReport) string { return formatDuration(time.Duration(r.DurationMS) * time.Millisecond) }},
+	}
+
+	available := terminalWidth() - 4 // panel borders and margin
+	deviceCols := func() int {
+		cols := available - 2 - statusCols
+		for _, c := range columns {
+			cols -= c.width + 1
+		}
+		return cols
+	}
+	for deviceCols() < minDeviceCols && len(columns) > 4 {
+		columns = columns[:len(columns)-1]
+	}
+	nameCols := max(deviceCols(), 1)
+
+	header := padRunes("Device", nameCols)
+	for _, c := range columns {
+		header += fmt.Sprintf(" %*s", c.width, c.title)
+	}
+	header += "  Status"
+	rows := []string{colorBold + header + colorReset}
+
+	for _, r := range reports {
+		name := strings.TrimSuffix(r.Device, "/")
+		row := padRunes(truncateRunes(name, nameCols), nameCols)
+		for _, c := range columns {
+			row += fmt.Sprintf(" %*s", c.width, c.value(r))
+		}
+		row += "  " + statusColor(r.Status) + r.Status + colorReset
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// runReport is everything -report writes about a run.
+type runReport struct {
+	Version    string          `json:"version"`
+	BaseURL    string          `json:"base_url"`
+	Started    time.Time       `json:"started"`
+	DurationMS int64           `json:"duration_ms"`
+	Totals     SyncSummary     `json:"totals"`
+	Errors     int             `json:"errors"`
+	ExitCode   int             `json:"exit_code"`
+	Log        string          `json:"log,omitempty"`
+	Devices    []*deviceReport `json:"devices"`
+}
+
+// reportFormat returns the report format for path by its extension:
+// "json", "md" or "html".
+func reportFormat(path string) (string, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return "json", nil
+	case ".md", ".markdown":
+		return "md", nil
+	case ".html", ".htm":
+		return "html", nil
+	}
+	return "", fmt.Errorf("report %s: extension must be .json, .md or .html", path)
+}
+
+// writeReport writes report to path in the format its extension selects.
+func writeReport(path string, report *runReport) error {
+	format, err := reportFormat(path)
+	if err != nil {
+		return err
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	switch format {
+	case "json":
+		enc := json.NewEncoder(file)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(report)
+	case "md":
+		_, err = file.WriteString(markdownReport(report))
+	case "html":
+		err = htmlReportTemplate.Execute(file, report)
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// markdownReport renders report as a Markdown document.
+func markdownReport(report *runReport) string {
+	// Cells may contain file names with pipes.
+	cell := func(s string) string { return strings.ReplaceAll(s, "|", `\|`) }
+	ms := func(n int64) string { return formatDuration(time.Duration(n) * time.Millisecond) }
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Myrientor run report\n\n")
+	fmt.Fprintf(&b, "- **Started:** %s\n", report.Started.Format("2006-01-02 15:04:05"))
+	fmt.Fprintf(&b, "- **Duration:** %s\n", ms(report.DurationMS))
+	fmt.Fprintf(&b, "- **Mirror:** %s\n", report.BaseURL)
+	fmt.Fprintf(&b, "- **Version:** %s\n", report.Version)
+	if report.Log != "" {
+		fmt.Fprintf(&b, "- **Log:** `%s`\n", report.Log)
+	}
+	t := report.Totals
+	fmt.Fprintf(&b, "- **Files:** %d downloaded, %d skipped, %d deleted, %d errors, %d cancelled\n",
+		t.FilesDownloaded, t.FilesSkipped, t.FilesDeleted, t.FilesErrors, t.FilesCancelled)
+	fmt.Fprintf(&b, "- **Transfer:** %s downloaded, %s skipped\n\n", formatBytes(t.BytesDownloaded), formatBytes(t.BytesSkipped))
+
+	fmt.Fprintf(&b, "## Devices\n\n")
+	fmt.Fprintf(&b, "| Device | Status | Downloaded | Skipped | Deleted | Errors | Bytes | Duration | Speed |\n")
+	fmt.Fprintf(&b, "|--------|--------|-----------:|--------:|--------:|-------:|------:|---------:|------:|\n")
+	for _, d := range report.Devices {
+		s := d.Summary
+		fmt.Fprintf(&b, "| %s | %s | %d | %d | %d | %d | %s | %s | %s/s |\n",
+			cell(d.Device), d.Status, s.FilesDownloaded, s.FilesSkipped, s.FilesDeleted, s.FilesErrors,
+			formatBytes(s.BytesDownloaded), ms(d.DurationMS), formatBytes(d.BytesPerSecond))
+	}
+
+	for _, d := range report.Devices {
+		fmt.Fprintf(&b, "\n## %s\n\n", d.Device)
+		fmt.Fprintf(&b, "Local path: `%s`\n", d.LocalDir)
+		if d.Error != "" {
+			fmt.Fprintf(&b, "\n**Error:** %s\n", d.Error)
+		}
+		if len(d.Downloaded) > 0 {
+			fmt.Fprintf(&b, "\n### Downloaded (%d)\n\n| File | Size | Duration |\n|------|-----:|---------:|\n", len(d.Downloaded))
+			for _, f := range d.Downloaded {
+				fmt.Fprintf(&b, "| %s | %s | %s |\n", cell(f.Path), formatBytes(f.Bytes), ms(f.DurationMS))
+			}
+		}
+		if len(d.Deleted) > 0 {
+			fmt.Fprintf(&b, "\n### Deleted (%d)\n\n", len(d.Deleted))
+			for _, f := range d.Deleted {
+				fmt.Fprintf(&b, "- `%s`\n", f.Path)
+			}
+		}
+		if len(d.Failed) > 0 {
+			fmt.Fprintf(&b, "\n### Failed (%d)\n\n| File | Class | Error |\n|------|-------|-------|\n", len(d.Failed))
+			for _, f := range d.Failed {
+				fmt.Fprintf(&b, "| %s | %s | %s |\n", cell(f.Path), f.Class, cell(f.Error))
+			}
+		}
+	}
+	return b.String()
+}
+
+var htmlReportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"bytes": formatBytes,
+	"ms":    func(n int64) string { return formatDuration(time.Duration(n) * time.Millisecond) },
+	"time":  func(t time.Time) string { return t.Format("2006-01-02 15:04:05") },
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Myrientor run report {{time .Started}}</title>
+<style>
+body { background: #0d0d14; color: #c8c8d8; font: 14px/1.5 ui-monospace, Menlo, Consolas, monospace; margin: 2em; }
+h1, h2, h3 { color: #00e5ff; font-weight: normal; }
+h2 { border-bottom: 1px solid #333; padding-bottom: .2em; margin-top: 2em; }
+table { border-collapse: collapse; margin: .5em 0 1em; }
+th, td { border: 1px solid #333; padding: .2em .6em; text-align: left; }
+th { color: #ff00aa; }
+td.num { text-align: right; }
+.ok { color: #00ff88; } .errors, .drained, .aborted { color: #ffcc00; } .failed { color: #ff4466; }
+code { color: #ff00aa; }
+</style>
+</head>
+<body>
+<h1>Myrientor run report</h1>
+<table>
+<tr><th>Started</th><td>{{time .Started}}</td></tr>
+<tr><th>Duration</th><td>{{ms .DurationMS}}</td></tr>
+<tr><th>Mirror</th><td>{{.BaseURL}}</td></tr>
+<tr><th>Version</th><td>{{.Version}}</td></tr>
+{{- if .Log}}
+<tr><th>Log</th><td><code>{{.Log}}</code></td></tr>
+{{- end}}
+<tr><th>Files</th><td>{{.Totals.FilesDownloaded}} downloaded, {{.Totals.FilesSkipped}} skipped, {{.Totals.FilesDeleted}} deleted, {{.Totals.FilesErrors}} errors, {{.Totals.FilesCancelled}} cancelled</td></tr>
+<tr><th>Transfer</th><td>{{bytes .Totals.BytesDownloaded}} downloaded, {{bytes .Totals.BytesSkipped}} skipped</td></tr>
+</table>
+
+<h2>Devices</h2>
+<table>
+<tr><th>Device</th><th>Status</th><th>Downloaded</th><th>Skipped</th><th>Deleted</th><th>Errors</th><th>Bytes</th><th>Duration</th><th>Speed</th></tr>
+{{- range .Devices}}
+<tr><td><a href="#{{.Device}}">{{.Device}}</a></td><td class="{{.Status}}">{{.Status}}</td><td class="num">{{.Summary.FilesDownloaded}}</td><td class="num">{{.Summary.FilesSkipped}}</td><td class="num">{{.Summary.FilesDeleted}}</td><td class="num">{{.Summary.FilesErrors}}</td><td class="num">{{bytes .Summary.BytesDownloaded}}</td><td class="num">{{ms .DurationMS}}</td><td class="num">{{bytes .BytesPerSecond}}/s</td></tr>
+{{- end}}
+</table>
+{{range .Devices}}
+<h2 id="{{.Device}}">{{.Device}}</h2>
+<p>Local path: <code>{{.LocalDir}}</code></p>
+{{- if .Error}}
+<p class="failed">Error: {{.Error}}</p>
+{{- end}}
+{{- if .Downloaded}}
+<h3>Downloaded ({{len .Downloaded}})</h3>
+<table>
+<tr><th>File</th><th>Size</th><th>Duration</th></tr>
+{{- range .Downloaded}}
+<tr><td>{{.Path}}</td><td class="num">{{bytes .Bytes}}</td><td class="num">{{ms .DurationMS}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+{{- if .Deleted}}
+<h3>Deleted ({{len .Deleted}})</h3>
+<table>
+{{- range .Deleted}}
+<tr><td>{{.Path}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+{{- if .Failed}}
+<h3>Failed ({{len .Failed}})</h3>
+<table>
+<tr><th>File</th><th>Class</th><th>Error</th></tr>
+{{- range .Failed}}
+<tr><td>{{.Path}}</td><td>{{.Class}}</td><td class="failed">{{.Error}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+{{end}}
+</body>
+</html>
+`))
@@ -0,0 +1,443 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// searchResultsFile holds the results of the last search so that `get`
+// can refer to them by number.
+const searchResultsFile = "myrientor-search.json"
+
+// searchQuery is a parsed search string. Parenthesised or bracketed groups
+// such as "(USA)" or "[!]" are tag filters; everything else is matched
+// against titles, and a word that equals a tag also counts as a match.
+type searchQuery struct {
+	Words []string // lower-cased free-text words
+	Tags  []string // lower-cased required tags
+}
+
+// parseSearchQuery splits a query into free-text words and tag filters.
+func parseSearchQuery(query string) searchQuery {
+	var q searchQuery
+	rest, groups := splitTagGroups(strings.ToLower(query))
+	for _, group := range groups {
+		q.Tags = append(q.Tags, group...)
+	}
+	q.Words = strings.Fields(rest)
+	return q
+}
+
+// titleAndTags splits a No-Intro/Redump style filename such as
+// "Tetris (World) (Rev 1) [!].zip" into its title ("tetris") and tags
+// ("world", "rev 1", "!"), all lower-cased.
+func titleAndTags(name string) (string, []string) {
+	if ext := path.Ext(name); !strings.ContainsAny(ext, " )]") {
+		name = strings.TrimSuffix(name, ext)
+	}
+	title, groups := splitTagGroups(strings.ToLower(name))
+	var tags []string
+	for _, group := range groups {
+		tags = append(tags, group...)
+	}
+	return strings.Join(strings.Fields(title), " "), tags
+}
+
+// splitTagGroups removes every (…) and […] group from s, returning the text
+// outside them and each group's comma-separated parts. Text after the first
+// group is kept in rest too, so "Tetris (World) Edition" still matches
+// "edition".
+func splitTagGroups(s string) (rest string, groups [][]string) {
+	var b strings.Builder
+	for len(s) > 0 {
+		open := strings.IndexAny(s, "([")
+		if open < 0 {
+			b.WriteString(s)
+			break
+		}
+		closer := ")"
+		if s[open] == '[' {
+			closer = "]"
+		}
+		end := strings.Index(s[open:], closer)
+		if end < 0 {
+			b.WriteString(s)
+			break
+		}
+		b.WriteString(s[:open])
+		b.WriteByte(' ')
+		var parts []string
+		for part := range strings.SplitSeq(s[open+1:open+end], ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				parts = append(parts, part)
+			}
+		}
+		groups = append(groups, parts)
+		s = s[open+end+1:]
+	}
+	return b.String(), groups
+}
+
+// hasTag reports whether tags contains want, or a tag starting with want
+// followed by a space ("rev" matches "rev 1").
+func hasTag(tags []string, want string) bool {
+	for _, tag := range tags {
+		if tag == want || strings.HasPrefix(tag, want+" ") {
+			return true
+		}
+	}
+	return false
+}
+
+// score rates how well a file name matches the query; ok is false if it
+// does not match at all. Whole-word title matches rank above substrings,
+// which rank above fuzzy subsequences.
+func (q searchQuery) score(name string) (score int, ok bool) {
+	title, tags := titleAndTags(name)
+	for _, tag := range q.Tags {
+		if !hasTag(tags, tag) {
+			return 0, false
+		}
+	}
+	for _, word := range q.Words {
+		i := strings.Index(title, word)
+		switch {
+		case i == 0 || i > 0 && !isWordRune(rune(title[i-1])):
+			score += 4
+		case i > 0:
+			score += 2
+		case hasTag(tags, word):
+			score += 3
+		case fuzzyMatch(word, title):
+			score++
+		default:
+			return 0, false
+		}
+	}
+	if title == strings.Join(q.Words, " ") {
+		score += 5
+	}
+	return score, true
+}
+
+func isWordRune(r rune) bool {
+	return r >= 'a' && r <= 'z' || r >= '0' && r <= '9'
+}
+
+// runSearchCommand implements `myrientor search <query>`: a fuzzy,
+// tag-aware search over the cached catalog of every device in remote.json.
+func runSearchCommand(args []string) int {
+	fs := flag.NewFlagSet("search", flag.ExitOnError)
+	flags := registerFlags(fs)
+	refresh := fs.Bool("refresh", false, "Rebuild the catalog from the mirror before searching")
+	limit := fs.Int("limit", 20, "Maximum number of results")
+	devicePattern := fs.String("device", "", "Only search devices matching local_path, remote_path or glob")
+	fs.Parse(args)
+
+	query := strings.Join(fs.Args(), " ")
+	if strings.TrimSpace(query) == "" && !*refresh {
+		fmt.Fprintf(os.Stderr, "%s✗ Usage: myrientor search [-refresh] [-device pattern] <query>%s\n", colorRed, colorReset)
+		return exitConfig
+	}
+
+	cfg, err := loadConfig(flags)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s✗ Config error: %v%s\n", colorRed, err, colorReset)
+		return exitConfig
+	}
+	settings, err := cfg.Settings().Resolve(cfg.Filter)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s✗ Invalid settings: %v%s\n", colorRed, err, colorReset)
+		return exitConfig
+	}
+
+	cat, err := loadCatalog()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s✗ Error reading catalog: %v%s\n", colorRed, err, colorReset)
+		return exitConfig
+	}
+	if *refresh || cat == nil || cat.BaseURL != settings.BaseURL {
+		cat = buildCatalog(settings.BaseURL, cfg.Remote.Devices, settings.MaxConcurrent,
+			func(done, total int, remotePath string) {
+				statusLine("%s  Cataloging %d/%d: %s%s", colorDim, done, total, fitInTerminal(remotePath, 24), colorReset)
+			},
+			func(remotePath string, err error) {
+				clearStatusLine()
+				fmt.Printf("%s⚠ %s: %v%s\n", colorYellow, remotePath, err, colorReset)
+			})
+		clearStatusLine()
+		if err := cat.Save(); err != nil {
+			fmt.Fprintf(os.Stderr, "%s✗ Error saving %s: %v%s\n", colorRed, catalogFile, err, colorReset)
+			return exitErrors
+		}
+		fmt.Printf("%s✓ Catalog updated: %d files%s\n", colorGreen, len(cat.Entries), colorReset)
+	} else if age := time.Since(cat.Updated); age > catalogMaxAge {
+		fmt.Printf("%sCatalog is %s old; run with -refresh to update it%s\n", colorDim, formatDuration(age), colorReset)
+	}
+	if strings.TrimSpace(query) == "" {
+		return exitOK
+	}
+
+	var allowed map[string]bool
+	if *devicePattern != "" {
+		devices, err := cfg.MatchDevices([]string{*devicePattern})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s✗ %v%s\n", colorRed, err, colorReset)
+			return exitConfig
+		}
+		allowed = make(map[string]bool)
+		for _, device := range devices {
+			allowed[device.RemotePath] = true
+		}
+	}
+
+	type match struct {
+		entry catalogEntry
+		score int
+	}
+	q := parseSearchQuery(query)
+	var matches []match
+	for _, entry := range cat.Entries {
+		if allowed != nil && !allowed[entry.RemotePath] {
+			continue
+		}
+		if score, ok := q.score(path.Base(entry.File)); ok {
+			matches = append(matches, match{entry, score})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].score != matches[j].score {
+			return matches[i].score > matches[j].score
+		}
+		return len(matches[i].entry.File) < len(matches[j].entry.File)
+	})
+
+	if len(matches) == 0 {
+		fmt.Printf("%sNo matches for %q%s\n", colorYellow, query, colorReset)
+		return exitOK
+	}
+
+	results := make([]catalogEntry, 0, min(*limit, len(matches)))
+	for _, m := range matches[:min(*limit, len(matches))] {
+		results = append(results, m.entry)
+	}
+	if err := saveSearchResults(results); err != nil {
+		fmt.Fprintf(os.Stderr, "%s✗ Error saving %s: %v%s\n", colorRed, searchResultsFile, err, colorReset)
+		return exitErrors
+	}
+
+	// number, size and separators
+	const fixedCols = 4 + 2 + 10 + 2
+	nameCols := max(terminalWidth()-fixedCols, 20)
+	for i, entry := range results {
+		fmt.Printf("%s%3d.%s %s  %s%10s%s\n", colorCyan, i+1, colorReset,
+			padRunes(truncateRunes(path.Base(entry.File), nameCols), nameCols),
+			colorDim, formatBytesIfKnown(entry.Size), colorReset)
+		fmt.Printf("     %s%s%s\n", colorDim, truncateRunes(entry.RemotePath+entry.File, nameCols+12), colorReset)
+	}
+	if len(matches) > len(results) {
+		fmt.Printf("%s  … %d more; narrow the query or raise -limit%s\n", colorDim, len(matches)-len(results), colorReset)
+	}
+	fmt.Printf("\n%sDownload with: myrientor get <number>…%s\n", colorDim, colorReset)
+	return exitOK
+}
+
+func saveSearchResults(results []catalogEntry) error {
+	data, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(searchResultsFile, data, 0644)
+}
+
+func loadSearchResults() ([]catalogEntry, error) {
+	data, err := os.ReadFile(searchResultsFile)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("no previous search; run myrientor search first")
+	}
+	if err != nil {
+		return nil, err
+	}
+	var results []catalogEntry
+	if err := json.Unmarshal(data, &results); err != nil {
+		return nil, fmt.Errorf("%s: %w", searchResultsFile, err)
+	}
+	return results, nil
+}
+
+// resolveGetTarget turns a `get` argument into a catalog entry: a result
+// number from the last search, or a remote path (optionally a full URL under
+// base_url) that falls under one of the devices in remote.json.
+func resolveGetTarget(arg string, cfg *Config, baseURL string, cat *catalog) (catalogEntry, error) {
+	if n, err := strconv.Atoi(arg); err == nil {
+		results, err := loadSearchResults()
+		if err != nil {
+			return catalogEntry{}, err
+		}
+		if n < 1 || n > len(results) {
+			return catalogEntry{}, fmt.Errorf("result %d out of range (1-%d)", n, len(results))
+		}
+		return results[n-1], nil
+	}
+
+	remote := strings.TrimPrefix(arg, baseURL)
+	if unescaped, err := url.PathUnescape(remote); err == nil {
+		remote = unescaped
+	}
+	var entry catalogEntry
+	for _, device := range cfg.Remote.Devices {
+		if strings.HasPrefix(remote, device.RemotePath) && len(device.RemotePath) > len(entry.RemotePath) {
+			entry = catalogEntry{RemotePath: device.RemotePath, File: strings.TrimPrefix(remote, device.RemotePath)}
+		}
+	}
+	if entry.RemotePath == "" || entry.File == "" || strings.HasSuffix(entry.File, "/") {
+		return catalogEntry{}, fmt.Errorf("%s is not a file under any device in remote.json", arg)
+	}
+	if cat != nil {
+		for _, known := range cat.Entries {
+			if known.RemotePath == entry.RemotePath && known.File == entry.File {
+				entry.Size = known.Size
+				break
+			}
+		}
+	}
+	return entry, nil
+}
+
+// getDevice returns the device a file is downloaded for: the first enabled
+// device with the entry's remote path, else the first one configured.
+func getDevice(cfg *Config, remotePath string) (Device, bool) {
+	var found *Device
+	for i := range cfg.Remote.Devices {
+		device := &cfg.Remote.Devices[i]
+		if device.RemotePath != remotePath {
+			continue
+		}
+		if found == nil || !found.ShouldSync() && device.ShouldSync() {
+			found = device
+		}
+	}
+	if found == nil {
+		return Device{}, false
+	}
+	devices := []Device{*found}
+	cfg.placeUnderRoot(devices)
+	return devices[0], true
+}
+
+// runGetCommand implements `myrientor get <result|path>…`: one-off
+// downloads into the matching device's local path, recorded in the sync
+// state like any synced file.
+func runGetCommand(args []string) int {
+	fs := flag.NewFlagSet("get", flag.ExitOnError)
+	flags := registerFlags(fs)
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fmt.Fprintf(os.Stderr, "%s✗ Usage: myrientor get <result number|remote path>…%s\n", colorRed, colorReset)
+		return exitConfig
+	}
+
+	cfg, err := loadConfig(flags)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s✗ Config error: %v%s\n", colorRed, err, colorReset)
+		return exitConfig
+	}
+	state, err := loadSyncState()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s✗ Error reading state file %s: %v%s\n", colorRed, stateFile, err, colorReset)
+		return exitConfig
+	}
+	cat, err := loadCatalog()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s✗ Error reading catalog: %v%s\n", colorRed, err, colorReset)
+		return exitConfig
+	}
+
+	quickClient := newQuickClient()
+	downloadClient := newDownloadClient(1)
+	failed := 0
+	for _, arg := range fs.Args() {
+		if err := getFile(arg, cfg, cat, state, quickClient, downloadClient); err != nil {
+			clearStatusLine()
+			fmt.Printf("%s✗ %s: %v%s\n", colorRed, arg, err, colorReset)
+			failed++
+		}
+	}
+
+	if err := state.Save(); err != nil {
+		fmt.Fprintf(os.Stderr, "%s✗ Error saving %s: %v%s\n", colorRed, stateFile, err, colorReset)
+		return exitErrors
+	}
+	if failed > 0 {
+		return exitErrors
+	}
+	return exitOK
+}
+
+// getFile downloads one `get` argument unless the local copy is up to date.
+func getFile(arg string, cfg *Config, cat *catalog, state *SyncState, quickClient, downloadClient *http.Client) error {
+	entry, err := resolveGetTarget(arg, cfg, cfg.Settings().BaseURL, cat)
+	if err != nil {
+		return err
+	}
+	device, ok := getDevice(cfg, entry.RemotePath)
+	if !ok {
+		return fmt.Errorf("no device in remote.json for %s", entry.RemotePath)
+	}
+	settings, err := cfg.DeviceSettings(device)
+	if err != nil {
+		return fmt.Errorf("invalid settings for %s: %w", device.RemotePath, err)
+	}
+
+	file := entry.fileInfo()
+	localFile := layoutFilePath(settings.Layout, device, file)
+	if owner, ok := state.Owner(localFile); ok && owner != deviceKey(device) {
+		return fmt.Errorf("%s is already owned by %s", localFile, owner)
+	}
+	remoteFile := remoteFileURL(settings.BaseURL+device.RemotePath, file)
+
+	needsDownload, _, err := shouldDownload(quickClient, remoteFile, localFile)
+	if err != nil {
+		return err
+	}
+	if !needsDownload {
+		fmt.Printf("%s= %s already up to date%s\n", colorDim, localFile, colorReset)
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(localFile), 0755); err != nil {
+		return err
+	}
+
+	opts := downloadOptions{
+		stallTimeout: settings.StallTimeout,
+		limiter:      newRateLimiter(settings.MaxSpeed),
+	}
+	start := time.Now()
+	bytes, err := downloadFile(context.Background(), downloadClient, remoteFile, localFile, opts, func(written, total int64) {
+		speed := int64(float64(written) / max(time.Since(start).Seconds(), 0.001))
+		suffix := fmt.Sprintf("%s @ %s/s", formatBytes(written), formatBytes(speed))
+		if total > 0 {
+			suffix = fmt.Sprintf("%.0f%% %s/%s @ %s/s", float64(written)/float64(total)*100, formatBytes(written), formatBytes(total), formatBytes(speed))
+		}
+		statusLine("%s", activityLine(colorCyan+"↓"+colorReset+" ", 2, file.Name, suffix))
+	})
+	if err != nil {
+		return err
+	}
+	state.RecordFile(device, localFile, FileState{Remote: file.RelPath(), Size: bytes})
+	clearStatusLine()
+	fmt.Printf("%s✓ %s%s %s(%s)%s\n", colorGreen, localFile, colorReset, colorDim, formatBytes(bytes), colorReset)
+	return nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSearchQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		want  searchQuery
+	}{
+		{"tetris", searchQuery{Words: []string{"tetris"}}},
+		{"Super Mario (USA)", searchQuery{Words: []string{"super", "mario"}, Tags: []string{"usa"}}},
+		{"zelda (USA, Europe) [!]", searchQuery{Words: []string{"zelda"}, Tags: []string{"usa", "europe", "!"}}},
+		{"(Japan)", searchQuery{Words: []string{}, Tags: []string{"japan"}}},
+	}
+	for _, tt := range tests {
+		if got := parseSearchQuery(tt.query); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseSearchQuery(%q) = %+v, want %+v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestSearchQueryScore(t *testing.T) {
+	tests := []struct {
+		query     string
+		name      string
+		wantScore int
+		wantOK    bool
+	}{
+		{"tetris", "Tetris (World).zip", 4 + 5, true},
+		{"tetris", "Tetris 2 (USA).zip", 4, true},
+		{"tris", "Tetris (World).zip", 2, true},
+		{"ttrs", "Tetris (World).zip", 1, true},
+		{"world", "Tetris (World).zip", 3, true},
+		{"tetris (usa)", "Tetris (World).zip", 0, false},
+		{"tetris (usa)", "Tetris (USA, Europe).zip", 4 + 5, true},
+		{"tetris (rev)", "Tetris (USA) (Rev 1).zip", 4 + 5, true},
+		{"mario", "Tetris (World).zip", 0, false},
+		{"super mario", "Super Mario Bros. (World).zip", 4 + 4, true},
+	}
+	for _, tt := range tests {
+		score, ok := parseSearchQuery(tt.query).score(tt.name)
+		if score != tt.wantScore || ok != tt.wantOK {
+			t.Errorf("score(%q, %q) = %d, %v, want %d, %v", tt.query, tt.name, score, ok, tt.wantScore, tt.wantOK)
+		}
+	}
+}
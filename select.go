@@ -0,0 +1,424 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+)
+
+type pickerMode int
+
+const (
+	pickerBrowse pickerMode = iota
+	pickerSearch
+	pickerEdit
+)
+
+// pickerRow is one line of the device list: either a group header or a device.
+type pickerRow struct {
+	group  string
+	device int // index into RemoteConfig.Devices, -1 for group headers
+}
+
+// picker is the state of the interactive device picker.
+type picker struct {
+	config      *RemoteConfig
+	mode        pickerMode
+	query       []rune
+	edit        []rune // local_path being edited
+	rows        []pickerRow
+	cursor      int  // index into rows, always on a device row when any exist
+	offset      int  // first visible row
+	dirty       bool // unsaved changes
+	saved       bool // saved at least once
+	confirmQuit bool
+	message     string
+}
+
+// runSelectCommand implements `myrientor select`: a full-screen picker for
+// enabling devices and editing their local_path, saved back to remote.json.
+func runSelectCommand(args []string) int {
+	fs := flag.NewFlagSet("select", flag.ExitOnError)
+	fs.Parse(args)
+
+	config, err := readRemoteConfigFile()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s✗ Error reading config file: %v%s\n", colorRed, err, colorReset)
+		return exitConfig
+	}
+
+	done := make(chan struct{})
+	keys, waitKeys, ok := readKeys(done)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "%s✗ select needs an interactive terminal%s\n", colorRed, colorReset)
+		return exitConfig
+	}
+
+	// Ctrl-C leaves the picker without saving but still restores the terminal.
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+
+	fmt.Print("\033[?1049h\033[?25l") // alternate screen, hide cursor
+
+	p := &picker{config: config}
+	p.refresh()
+
+	// Redraw periodically as well as on input so a resized terminal is
+	// picked up without a key press.
+	ticker := time.NewTicker(250 * time.Millisecond)
+	defer ticker.Stop()
+
+loop:
+	for {
+		fmt.Print(p.render())
+		select {
+		case key, ok := <-keys:
+			if !ok {
+				break loop
+			}
+			quit, err := p.handle(key)
+			if err != nil {
+				p.message = fmt.Sprintf("%s✗ Error saving: %v%s", colorRed, err, colorReset)
+			}
+			if quit {
+				break loop
+			}
+		case <-interrupt:
+			break loop
+		case <-ticker.C:
+		}
+	}
+
+	close(done)
+	waitKeys()
+	fmt.Print("\033[?25h\033[?1049l") // show cursor, leave alternate screen
+
+	switch {
+	case p.dirty:
+		fmt.Printf("%s✗ Changes discarded%s\n", colorYellow, colorReset)
+	case p.saved:
+		fmt.Printf("%s✓ Saved %s (%d device(s) enabled)%s\n", colorGreen, remoteConfigFile, config.SyncableCount(), colorReset)
+	default:
+		fmt.Printf("%sNo changes%s\n", colorDim, colorReset)
+	}
+	return exitOK
+}
+
+// deviceGroup returns the top-level collection of a remote path, e.g. MAME,
+// No-Intro or Redump.
+func deviceGroup(remotePath string) string {
+	group, _, _ := strings.Cut(remotePath, "/")
+	return group
+}
+
+// fuzzyMatch reports whether every whitespace-separated word of query appears
+// in text as a case-insensitive subsequence.
+func fuzzyMatch(query, text string) bool {
+	text = strings.ToLower(text)
+	for _, word := range strings.Fields(strings.ToLower(query)) {
+		rest := text
+		for _, r := range word {
+			i := strings.IndexRune(rest, r)
+			if i < 0 {
+				return false
+			}
+			rest = rest[i+len(string(r)):]
+		}
+	}
+	return true
+}
+
+// refresh rebuilds the visible rows from the search query, keeping the
+// cursor on the same device where possible.
+func (p *picker) refresh() {
+	current := -1
+	if p.cursor < len(p.rows) {
+		current = p.rows[p.cursor].device
+	}
+
+	var groups []string
+	byGroup := make(map[string][]int)
+	for i, device := range p.config.Devices {
+		if !fuzzyMatch(string(p.query), device.RemotePath+" "+device.LocalPath) {
+			continue
+		}
+		group := deviceGroup(device.RemotePath)
+		if _, ok := byGroup[group]; !ok {
+			groups = append(groups, group)
+		}
+		byGroup[group] = append(byGroup[group], i)
+	}
+
+	p.rows = p.rows[:0]
+	p.cursor = -1
+	for _, group := range groups {
+		p.rows = append(p.rows, pickerRow{group: group, device: -1})
+		for _, i := range byGroup[group] {
+			if i == current {
+				p.cursor = len(p.rows)
+			}
+			p.rows = append(p.rows, pickerRow{group: group, device: i})
+		}
+	}
+	if p.cursor < 0 {
+		p.cursor = 0
+		p.move(1)
+	}
+}
+
+// move shifts the cursor by delta device rows, skipping group headers and
+// stopping at either end of the list.
+func (p *picker) move(delta int) {
+	step := 1
+	if delta < 0 {
+		step, delta = -1, -delta
+	}
+	pos := p.cursor
+	for delta > 0 {
+		next := pos + step
+		for next >= 0 && next < len(p.rows) && p.rows[next].device < 0 {
+			next += step
+		}
+		if next < 0 || next >= len(p.rows) {
+			break
+		}
+		pos = next
+		delta--
+	}
+	if pos < len(p.rows) && p.rows[pos].device >= 0 {
+		p.cursor = pos
+	}
+}
+
+// current returns the device under the cursor, or nil if the list is empty.
+func (p *picker) current() *Device {
+	if p.cursor >= len(p.rows) || p.rows[p.cursor].device < 0 {
+		return nil
+	}
+	return &p.config.Devices[p.rows[p.cursor].device]
+}
+
+// setVisible enables or disables every device matching the current search.
+func (p *picker) setVisible(sync bool) {
+	for _, row := range p.rows {
+		if row.device >= 0 && p.config.Devices[row.device].Sync != sync {
+			p.config.Devices[row.device].Sync = sync
+			p.dirty = true
+		}
+	}
+}
+
+// handle applies one key press and reports whether the picker should exit.
+func (p *picker) handle(key termKey) (quit bool, err error) {
+	p.message = ""
+	listHeight := max(terminalHeight()-4, 1)
+
+	// Navigation works the same in every mode.
+	switch key.Code {
+	case keyUp:
+		p.move(-1)
+		return false, nil
+	case keyDown:
+		p.move(1)
+		return false, nil
+	case keyPageUp:
+		p.move(-listHeight)
+		return false, nil
+	case keyPageDown:
+		p.move(listHeight)
+		return false, nil
+	}
+
+	switch p.mode {
+	case pickerSearch:
+		switch key.Code {
+		case keyRune:
+			p.query = append(p.query, key.Rune)
+			p.refresh()
+		case keyBackspace:
+			if len(p.query) > 0 {
+				p.query = p.query[:len(p.query)-1]
+				p.refresh()
+			}
+		case keyEnter:
+			p.mode = pickerBrowse
+		case keyEscape:
+			p.query = nil
+			p.mode = pickerBrowse
+			p.refresh()
+		}
+		return false, nil
+
+	case pickerEdit:
+		switch key.Code {
+		case keyRune:
+			p.edit = append(p.edit, key.Rune)
+		case keyBackspace:
+			if len(p.edit) > 0 {
+				p.edit = p.edit[:len(p.edit)-1]
+			}
+		case keyEnter:
+			if device := p.current(); device != nil {
+				if newPath := strings.TrimSpace(string(p.edit)); newPath != device.LocalPath {
+					device.LocalPath = newPath
+					p.dirty = true
+				}
+			}
+			p.mode = pickerBrowse
+		case keyEscape:
+			p.mode = pickerBrowse
+		}
+		return false, nil
+	}
+
+	switch key.Code {
+	case keyHome:
+		p.cursor = 0
+		p.move(1)
+	case keyEnd:
+		p.cursor = len(p.rows) - 1
+		p.move(-1)
+	case keyTab:
+		// Jump to the first device of the next group
+		for i := p.cursor + 1; i < len(p.rows); i++ {
+			if p.rows[i].device < 0 {
+				p.cursor = i
+				p.move(1)
+				break
+			}
+		}
+	case keyEscape:
+		return p.quit(), nil
+	case keyRune:
+		switch key.Rune {
+		case 'k':
+			p.move(-1)
+		case 'j':
+			p.move(1)
+		case ' ':
+			if device := p.current(); device != nil {
+				device.Sync = !device.Sync
+				p.dirty = true
+			}
+		case 'a':
+			p.setVisible(true)
+		case 'n':
+			p.setVisible(false)
+		case '/':
+			p.mode = pickerSearch
+		case 'e':
+			if device := p.current(); device != nil {
+				p.edit = []rune(device.LocalPath)
+				p.mode = pickerEdit
+			}
+		case 's':
+			if err := writeRemoteConfigFile(p.config); err != nil {
+				return false, err
+			}
+			p.dirty = false
+			p.saved = true
+			p.confirmQuit = false
+			p.message = fmt.Sprintf("%s✓ Saved %s%s", colorGreen, remoteConfigFile, colorReset)
+		case 'q', 'Q':
+			return p.quit(), nil
+		}
+	}
+	return false, nil
+}
+
+// quit reports whether the picker may exit, asking for a second press first
+// when there are unsaved changes.
+func (p *picker) quit() bool {
+	if !p.dirty || p.confirmQuit {
+		return true
+	}
+	p.confirmQuit = true
+	p.message = fmt.Sprintf("%sUnsaved changes: press q again to discard, s to save%s", colorYellow, colorReset)
+	return false
+}
+
+// render draws the whole screen: header panel with the search box, the
+// scrolling device list, and a footer with key help or the edit prompt.
+func (p *picker) render() string {
+	tw := terminalWidth()
+	listHeight := max(terminalHeight()-4, 1)
+
+	// Keep the cursor inside the visible window
+	if p.cursor < p.offset {
+		p.offset = p.cursor
+	}
+	if p.cursor >= p.offset+listHeight {
+		p.offset = p.cursor - listHeight + 1
+	}
+	// Show the group header above the first device when scrolled to the top
+	if p.offset == 1 && len(p.rows) > 0 && p.rows[0].device < 0 {
+		p.offset = 0
+	}
+
+	var b strings.Builder
+	b.WriteString("\033[H")
+	writeLine := func(line string) {
+		b.WriteString(line)
+		b.WriteString("\033[K\n")
+	}
+
+	writeLine(panelTopLabeled(fmt.Sprintf("SELECT  %d/%d enabled", p.config.SyncableCount(), len(p.config.Devices))))
+	search := string(p.query)
+	if p.mode == pickerSearch {
+		search += colorMagenta + "█" + colorReset
+	} else if search == "" {
+		search = colorDim + "press / to search" + colorReset
+	}
+	writeLine(panelLine(fmt.Sprintf("%sSearch:%s %s", colorBold, colorReset, search)))
+	writeLine(panelBottom())
+
+	for i := p.offset; i < p.offset+listHeight; i++ {
+		if i >= len(p.rows) {
+			writeLine("")
+			continue
+		}
+		row := p.rows[i]
+		if row.device < 0 {
+			writeLine(fmt.Sprintf("%s%s── %s %s%s", colorBold, colorCyan, row.group, strings.Repeat("─", max(tw-len([]rune(row.group))-5, 0)), colorReset))
+			continue
+		}
+
+		device := p.config.Devices[row.device]
+		marker := "  "
+		if i == p.cursor {
+			marker = colorMagenta + "▶ " + colorReset
+		}
+		check := colorDim + "[ ]" + colorReset
+		if device.Sync {
+			check = colorGreen + "[✓]" + colorReset
+		}
+		localPath := device.LocalPath
+		if i == p.cursor && p.mode == pickerEdit {
+			localPath = string(p.edit) + "_"
+		}
+		name := strings.TrimPrefix(device.RemotePath, row.group+"/")
+		writeLine(activityLine(marker+check+" ", 6, name, " "+localPath))
+	}
+
+	// Footer stays on the last line without a trailing newline so the
+	// screen never scrolls.
+	footer := p.message
+	if footer == "" {
+		switch p.mode {
+		case pickerSearch:
+			footer = "type to filter  enter done  esc clear"
+		case pickerEdit:
+			footer = "editing local_path  enter confirm  esc cancel"
+		default:
+			footer = "↑↓ move  space toggle  a/n all/none  / search  e edit path  tab next group  s save  q quit"
+		}
+		footer = colorDim + fitInTerminal(footer, 1) + colorReset
+	}
+	b.WriteString(footer)
+	b.WriteString("\033[K")
+	return b.String()
+}
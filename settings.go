@@ -0,0 +1,258 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	deletePolicyDelete = "delete" // remove local files that no longer exist remotely
+	deletePolicyKeep   = "keep"   // never remove local files
+)
+
+// Settings are the tunable sync options. They can be set globally in
+// local.json, per profile, per device in remote.json, and via CLI flags.
+// Zero values mean "not set" so that layers can be merged.
+type Settings struct {
+	MaxConcurrent int    `json:"max_concurrent,omitempty"`
+	BaseURL       string `json:"base_url,omitempty"`
+	DeletePolicy  string `json:"delete_policy,omitempty"`  // "delete" or "keep"
+	StallTimeout  int    `json:"stall_timeout,omitempty"`  // seconds without data before a download is retried
+	MaxSpeed      string `json:"max_speed,omitempty"`      // bandwidth cap per device, e.g. "5 MiB"
+	Layout        string `json:"layout,omitempty"`         // local path template, see layout.go
+	MinFreeSpace  string `json:"min_free_space,omitempty"` // drain when free disk space drops below this, e.g. "10 GiB"
+	LogRetention  int    `json:"log_retention,omitempty"`  // days to keep logs before prune removes them
+	LogLevel      string `json:"log_level,omitempty"`      // "debug", "info", "warn" or "error"
+	LogFormat     string `json:"log_format,omitempty"`     // "text" or "json"
+	LogDir        string `json:"log_dir,omitempty"`        // directory for log files
+	LogMaxSize    string `json:"log_max_size,omitempty"`   // rotate the log file past this size, e.g. "10 MiB"
+	LogAudit      *bool  `json:"log_audit,omitempty"`      // also log successful downloads and deletions; nil if unset
+}
+
+// SyncSettings is the effective configuration for syncing one device after
+// all setting layers have been applied and parsed.
+type SyncSettings struct {
+	BaseURL        string
+	MaxConcurrent  int
+	DeleteObsolete bool
+	StallTimeout   time.Duration
+	MaxSpeed       int64 // bytes per second, 0 means unlimited
+	Layout         string
+	MinFreeSpace   int64 // bytes, 0 means no threshold
+	Filter         FileFilter
+	Force          bool // sync even if the preflight estimate exceeds free space (-force)
+	RetryFailed    bool // only retry the files recorded in myrientor-failed.json (-retry-failed)
+}
+
+// defaultSettings is the lowest settings layer.
+var defaultSettings = Settings{
+	MaxConcurrent: defaultMaxConcurrent,
+	DeletePolicy:  deletePolicyDelete,
+	StallTimeout:  int(downloadStallTimeout / time.Second),
+	Layout:        defaultLayout,
+	LogRetention:  defaultLogRetention,
+	LogLevel:      defaultLogLevel,
+	LogFormat:     defaultLogFormat,
+	LogMaxSize:    defaultLogMaxSize,
+}
+
+// Merge returns s with every field that is set in over replaced.
+func (s Settings) Merge(over Settings) Settings {
+	if over.MaxConcurrent > 0 {
+		s.MaxConcurrent = over.MaxConcurrent
+	}
+	if over.BaseURL != "" {
+		s.BaseURL = over.BaseURL
+	}
+	if over.DeletePolicy != "" {
+		s.DeletePolicy = over.DeletePolicy
+	}
+	if over.StallTimeout > 0 {
+		s.StallTimeout = over.StallTimeout
+	}
+	if over.MaxSpeed != "" {
+		s.MaxSpeed = over.MaxSpeed
+	}
+	if over.Layout != "" {
+		s.Layout = over.Layout
+	}
+	if over.MinFreeSpace != "" {
+		s.MinFreeSpace = over.MinFreeSpace
+	}
+	if over.LogRetention > 0 {
+		s.LogRetention = over.LogRetention
+	}
+	if over.LogLevel != "" {
+		s.LogLevel = over.LogLevel
+	}
+	if over.LogFormat != "" {
+		s.LogFormat = over.LogFormat
+	}
+	if over.LogDir != "" {
+		s.LogDir = over.LogDir
+	}
+	if over.LogMaxSize != "" {
+		s.LogMaxSize = over.LogMaxSize
+	}
+	if over.LogAudit != nil {
+		s.LogAudit = over.LogAudit
+	}
+	return s
+}
+
+// settingField is one setting as displayed by `config show`.
+type settingField struct {
+	Key   string // JSON key
+	Value string // empty if unset
+}
+
+// Fields returns the settings in display order, keyed by their JSON names.
+func (s Settings) Fields() []settingField {
+	itoa := func(n int) string {
+		if n == 0 {
+			return ""
+		}
+		return strconv.Itoa(n)
+	}
+	btoa := func(b *bool) string {
+		if b == nil {
+			return ""
+		}
+		return strconv.FormatBool(*b)
+	}
+	return []settingField{
+		{"max_concurrent", itoa(s.MaxConcurrent)},
+		{"base_url", s.BaseURL},
+		{"delete_policy", s.DeletePolicy},
+		{"stall_timeout", itoa(s.StallTimeout)},
+		{"max_speed", s.MaxSpeed},
+		{"layout", s.Layout},
+		{"min_free_space", s.MinFreeSpace},
+		{"log_retention", itoa(s.LogRetention)},
+		{"log_level", s.LogLevel},
+		{"log_format", s.LogFormat},
+		{"log_dir", s.LogDir},
+		{"log_max_size", s.LogMaxSize},
+		{"log_audit", btoa(s.LogAudit)},
+	}
+}
+
+// LogOptions validates the logging settings.
+func (s Settings) LogOptions() (logOptions, error) {
+	level, err := parseLogLevel(s.LogLevel)
+	if err != nil {
+		return logOptions{}, err
+	}
+	if s.LogFormat != logFormatText && s.LogFormat != logFormatJSON {
+		return logOptions{}, fmt.Errorf("log_format %q must be %q or %q", s.LogFormat, logFormatText, logFormatJSON)
+	}
+	var maxSize int64
+	if s.LogMaxSize != "" {
+		if maxSize, err = parseByteSize(s.LogMaxSize); err != nil {
+			return logOptions{}, fmt.Errorf("log_max_size: %w", err)
+		}
+	}
+	return logOptions{
+		Level:   level,
+		Format:  s.LogFormat,
+		Dir:     s.LogDir,
+		MaxSize: maxSize,
+		Audit:   s.LogAudit != nil && *s.LogAudit,
+	}, nil
+}
+
+// Resolve validates merged settings and converts them into SyncSettings.
+func (s Settings) Resolve(filter FileFilter) (SyncSettings, error) {
+	if s.BaseURL == "" {
+		return SyncSettings{}, fmt.Errorf("base_url is not set")
+	}
+	if !strings.HasSuffix(s.BaseURL, "/") {
+		return SyncSettings{}, fmt.Errorf("base_url %q must end with /", s.BaseURL)
+	}
+	if s.MaxConcurrent < 1 {
+		return SyncSettings{}, fmt.Errorf("max_concurrent must be at least 1")
+	}
+
+	var deleteObsolete bool
+	switch s.DeletePolicy {
+	case deletePolicyDelete:
+		deleteObsolete = true
+	case deletePolicyKeep:
+		deleteObsolete = false
+	default:
+		return SyncSettings{}, fmt.Errorf("delete_policy %q must be %q or %q", s.DeletePolicy, deletePolicyDelete, deletePolicyKeep)
+	}
+
+	var maxSpeed int64
+	if s.MaxSpeed != "" {
+		var err error
+		if maxSpeed, err = parseByteSize(s.MaxSpeed); err != nil {
+			return SyncSettings{}, fmt.Errorf("max_speed: %w", err)
+		}
+	}
+
+	// A single read must not take longer than the stall timeout to pay off.
+	if maxSpeed > 0 && downloadBufferSize/maxSpeed >= int64(s.StallTimeout) {
+		return SyncSettings{}, fmt.Errorf("max_speed %s is too low for stall_timeout %ds, it must be at least %s",
+			s.MaxSpeed, s.StallTimeout, formatBytes(downloadBufferSize/int64(max(s.StallTimeout, 1))+1))
+	}
+
+	var minFreeSpace int64
+	if s.MinFreeSpace != "" {
+		var err error
+		if minFreeSpace, err = parseByteSize(s.MinFreeSpace); err != nil {
+			return SyncSettings{}, fmt.Errorf("min_free_space: %w", err)
+		}
+	}
+
+	if err := validateLayout(s.Layout); err != nil {
+		return SyncSettings{}, err
+	}
+
+	return SyncSettings{
+		BaseURL:        s.BaseURL,
+		MaxConcurrent:  s.MaxConcurrent,
+		DeleteObsolete: deleteObsolete,
+		StallTimeout:   time.Duration(s.StallTimeout) * time.Second,
+		MaxSpeed:       maxSpeed,
+		Layout:         s.Layout,
+		MinFreeSpace:   minFreeSpace,
+		Filter:         filter,
+	}, nil
+}
+
+// parseByteSize parses a human-readable size such as "750 KiB", "5MiB",
+// "1.5 GiB" or a plain byte count.
+func parseByteSize(sizeStr string) (int64, error) {
+	sizeStr = strings.TrimSpace(sizeStr)
+	numEnd := strings.IndexFunc(sizeStr, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	if numEnd == -1 {
+		numEnd = len(sizeStr)
+	}
+
+	value, err := strconv.ParseFloat(sizeStr[:numEnd], 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("invalid size %q", sizeStr)
+	}
+
+	multiplier := int64(1)
+	switch unit := strings.TrimSpace(sizeStr[numEnd:]); unit {
+	case "", "B":
+	case "KiB", "K", "KB":
+		multiplier = 1024
+	case "MiB", "M", "MB":
+		multiplier = 1024 * 1024
+	case "GiB", "G", "GB":
+		multiplier = 1024 * 1024 * 1024
+	case "TiB", "T", "TB":
+		multiplier = 1024 * 1024 * 1024 * 1024
+	default:
+		return 0, fmt.Errorf("invalid size unit %q in %q", unit, sizeStr)
+	}
+
+	return int64(value * float64(multiplier)), nil
+}
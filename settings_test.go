@@ -0,0 +1,158 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseByteSize(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{"0", 0, false},
+		{"512", 512, false},
+		{"512 B", 512, false},
+		{"750 KiB", 750 * 1024, false},
+		{"5MiB", 5 * 1024 * 1024, false},
+		{"5 MB", 5 * 1024 * 1024, false},
+		{"1.5 GiB", 1536 * 1024 * 1024, false},
+		{"2T", 2 * 1024 * 1024 * 1024 * 1024, false},
+		{"  10 K  ", 10 * 1024, false},
+		{"", 0, true},
+		{"MiB", 0, true},
+		{"5 XB", 0, true},
+		{"5 mib", 0, true},
+		{"1.2.3 KiB", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseByteSize(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseByteSize(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseByteSize(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSettingsMerge(t *testing.T) {
+	yes, no := true, false
+	base := Settings{
+		MaxConcurrent: 4,
+		BaseURL:       "https://a.example/",
+		DeletePolicy:  deletePolicyDelete,
+		StallTimeout:  30,
+		MaxSpeed:      "5 MiB",
+		LogAudit:      &yes,
+	}
+	tests := []struct {
+		name string
+		over Settings
+		want Settings
+	}{
+		{
+			name: "empty layer changes nothing",
+			over: Settings{},
+			want: base,
+		},
+		{
+			name: "set fields override",
+			over: Settings{MaxConcurrent: 8, DeletePolicy: deletePolicyKeep, MinFreeSpace: "1 GiB"},
+			want: Settings{
+				MaxConcurrent: 8,
+				BaseURL:       "https://a.example/",
+				DeletePolicy:  deletePolicyKeep,
+				StallTimeout:  30,
+				MaxSpeed:      "5 MiB",
+				MinFreeSpace:  "1 GiB",
+				LogAudit:      &yes,
+			},
+		},
+		{
+			name: "log_audit false overrides true",
+			over: Settings{LogAudit: &no},
+			want: Settings{
+				MaxConcurrent: 4,
+				BaseURL:       "https://a.example/",
+				DeletePolicy:  deletePolicyDelete,
+				StallTimeout:  30,
+				MaxSpeed:      "5 MiB",
+				LogAudit:      &no,
+			},
+		},
+	}
+	for _, tt := range tests {
+		got := base.Merge(tt.over)
+		if !settingsEqual(got, tt.want) {
+			t.Errorf("%s: Merge = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// TestSettingsMergeLayers checks that later layers win: defaults, then
+// local.json, a profile, a device and finally the CLI flags.
+func TestSettingsMergeLayers(t *testing.T) {
+	yes, no := true, false
+	layers := []Settings{
+		{BaseURL: "https://local.example/", LogAudit: &yes},
+		{MaxConcurrent: 2, MaxSpeed: "1 MiB"},
+		{MaxSpeed: "2 MiB", Layout: "{local_path}/{name}"},
+		{MaxConcurrent: 6, LogAudit: &no},
+	}
+	got := defaultSettings
+	for _, layer := range layers {
+		got = got.Merge(layer)
+	}
+
+	want := defaultSettings
+	want.BaseURL = "https://local.example/"
+	want.MaxConcurrent = 6
+	want.MaxSpeed = "2 MiB"
+	want.Layout = "{local_path}/{name}"
+	want.LogAudit = &no
+	if !settingsEqual(got, want) {
+		t.Errorf("merged layers = %+v, want %+v", got, want)
+	}
+}
+
+// settingsEqual compares settings by value, including the LogAudit pointee.
+func settingsEqual(a, b Settings) bool {
+	if (a.LogAudit == nil) != (b.LogAudit == nil) || a.LogAudit != nil && *a.LogAudit != *b.LogAudit {
+		return false
+	}
+	a.LogAudit, b.LogAudit = nil, nil
+	return a == b
+}
+
+func TestSettingsResolve(t *testing.T) {
+	valid := defaultSettings.Merge(Settings{BaseURL: "https://a.example/"})
+	tests := []struct {
+		name    string
+		over    Settings
+		wantErr string
+	}{
+		{"defaults", Settings{}, ""},
+		{"base_url without slash", Settings{BaseURL: "https://a.example"}, "must end with /"},
+		{"unknown delete_policy", Settings{DeletePolicy: "trash"}, "delete_policy"},
+		{"bad max_speed", Settings{MaxSpeed: "fast"}, "max_speed"},
+		{"max_speed too low for stall_timeout", Settings{MaxSpeed: "1 KiB", StallTimeout: 30}, "too low"},
+		{"max_speed just enough", Settings{MaxSpeed: "2 KiB", StallTimeout: 30}, ""},
+		{"bad min_free_space", Settings{MinFreeSpace: "lots"}, "min_free_space"},
+		{"bad layout", Settings{Layout: "{local_path}/{system}/{name}"}, "unknown placeholder"},
+	}
+	for _, tt := range tests {
+		got, err := valid.Merge(tt.over).Resolve(FileFilter{})
+		switch {
+		case tt.wantErr == "" && err != nil:
+			t.Errorf("%s: Resolve error = %v", tt.name, err)
+		case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+			t.Errorf("%s: Resolve error = %v, want one containing %q", tt.name, err, tt.wantErr)
+		case tt.wantErr == "" && got.StallTimeout != time.Duration(valid.Merge(tt.over).StallTimeout)*time.Second:
+			t.Errorf("%s: StallTimeout = %v", tt.name, got.StallTimeout)
+		}
+	}
+}
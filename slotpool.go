@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+// maxConcurrentLimit caps how far the concurrency hotkeys can grow the slot
+// pool, unless max_concurrent is already set higher.
+const maxConcurrentLimit = 32
+
+// slotPool hands out activity slots to downloads, at most limit at a time.
+// The limit can change while downloads run: growing it frees slots at once,
+// shrinking it lets the downloads above the new limit finish first. Slots
+// are numbered from 0 and handed out lowest first, so they index the
+// per-slot arrays in SyncStats. A download can bind its cancel function to
+// its slot so that the skip hotkey can cancel it by slot number.
+type slotPool struct {
+	mu      sync.Mutex
+	limit   int
+	max     int
+	busy    []bool
+	cancels []context.CancelCauseFunc
+	inUse   int
+	changed chan struct{} // closed and replaced whenever a slot may have become free
+}
+
+func newSlotPool(limit int) *slotPool {
+	return &slotPool{
+		limit:   limit,
+		max:     max(limit, maxConcurrentLimit),
+		busy:    make([]bool, limit),
+		cancels: make([]context.CancelCauseFunc, limit),
+		changed: make(chan struct{}),
+	}
+}
+
+// TryAcquire takes the lowest free slot. If none is free it returns ok false
+// and a channel that is closed once one may have become free.
+func (p *slotPool) TryAcquire() (slot int, ok bool, changed <-chan struct{}) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.inUse < p.limit {
+		for i := range p.limit {
+			if !p.busy[i] {
+				p.busy[i] = true
+				p.inUse++
+				return i, true, nil
+			}
+		}
+	}
+	return 0, false, p.changed
+}
+
+// Release returns a slot taken by TryAcquire.
+func (p *slotPool) Release(slot int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.busy[slot] = false
+	p.cancels[slot] = nil
+	p.inUse--
+	p.notifyLocked()
+}
+
+// Resize changes the limit by delta, keeping it between 1 and the pool's
+// maximum, and returns the new limit.
+func (p *slotPool) Resize(delta int) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.limit = min(max(p.limit+delta, 1), p.max)
+	for len(p.busy) < p.limit {
+		p.busy = append(p.busy, false)
+		p.cancels = append(p.cancels, nil)
+	}
+	p.notifyLocked()
+	return p.limit
+}
+
+// Bind sets the function that cancels the download holding slot.
+func (p *slotPool) Bind(slot int, cancel context.CancelCauseFunc) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.cancels[slot] = cancel
+}
+
+// Cancel cancels the download holding slot with cause, and reports whether
+// there was one.
+func (p *slotPool) Cancel(slot int, cause error) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if slot < 0 || slot >= len(p.cancels) || p.cancels[slot] == nil {
+		return false
+	}
+	p.cancels[slot](cause)
+	return true
+}
+
+func (p *slotPool) notifyLocked() {
+	close(p.changed)
+	p.changed = make(chan struct{})
+}
@@ -0,0 +1,61 @@
+package main
+
+import "testing"
+
+func TestSlotPoolResize(t *testing.T) {
+	tests := []struct {
+		name  string
+		limit int
+		delta int
+		want  int
+	}{
+		{"grow", 4, 2, 6},
+		{"shrink", 4, -2, 2},
+		{"not below 1", 2, -5, 1},
+		{"not above the maximum", 30, 5, maxConcurrentLimit},
+		{"max_concurrent above the maximum", 40, 1, 40},
+		{"shrink from above the maximum", 40, -1, 39},
+	}
+	for _, tt := range tests {
+		if got := newSlotPool(tt.limit).Resize(tt.delta); got != tt.want {
+			t.Errorf("%s: Resize(%d) from %d = %d, want %d", tt.name, tt.delta, tt.limit, got, tt.want)
+		}
+	}
+}
+
+func TestSlotPoolAcquire(t *testing.T) {
+	pool := newSlotPool(2)
+	for want := range 2 {
+		if slot, ok, _ := pool.TryAcquire(); !ok || slot != want {
+			t.Fatalf("TryAcquire = %d, %v, want %d, true", slot, ok, want)
+		}
+	}
+	_, ok, changed := pool.TryAcquire()
+	if ok {
+		t.Fatal("TryAcquire succeeded on a full pool")
+	}
+
+	// Growing the pool frees a slot at once and wakes waiters.
+	pool.Resize(1)
+	select {
+	case <-changed:
+	default:
+		t.Error("Resize did not signal waiters")
+	}
+	if slot, ok, _ := pool.TryAcquire(); !ok || slot != 2 {
+		t.Errorf("TryAcquire after growing = %d, %v, want 2, true", slot, ok)
+	}
+
+	// Shrinking lets running downloads finish; no slot is free until the
+	// number in use drops below the new limit.
+	pool.Resize(-2)
+	pool.Release(0)
+	pool.Release(2)
+	if _, ok, _ := pool.TryAcquire(); ok {
+		t.Error("TryAcquire succeeded with 1 of 1 slots in use")
+	}
+	pool.Release(1)
+	if slot, ok, _ := pool.TryAcquire(); !ok || slot != 0 {
+		t.Errorf("TryAcquire after releasing = %d, %v, want 0, true", slot, ok)
+	}
+}
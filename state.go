@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const stateFile = "myrientor-state.json"
+
+// SyncState records which local files myrientor wrote for each device, so
+// that cleanup only ever touches files it owns. It is safe for concurrent use.
+type SyncState struct {
+	mu      sync.Mutex
+	path    string
+	owners  map[string]string       // local file path → device key
+	Devices map[string]*DeviceState `json:"devices"`
+}
+
+// DeviceState is the recorded state of one device, keyed by deviceKey.
+type DeviceState struct {
+	RemotePath string               `json:"remote_path"`
+	LocalPath  string               `json:"local_path"`
+	LastSync   time.Time            `json:"last_sync,omitzero"` // last run that finished without drain or errors
+	Files      map[string]FileState `json:"files"`              // keyed by local file path, slash-separated
+}
+
+// FileState describes one owned local file.
+type FileState struct {
+	Remote  string `json:"remote"` // path relative to remote_path, slash-separated
+	Size    int64  `json:"size"`
+	Requeue bool   `json:"requeue,omitempty"` // re-download on next sync (set by verify)
+}
+
+// deviceKey identifies a device by where it syncs from and to, so the same
+// remote path synced into two libraries is tracked separately.
+func deviceKey(device Device) string {
+	return filepath.ToSlash(device.LocalPath) + "|" + device.RemotePath
+}
+
+// loadSyncState reads the state file, returning empty state if it does not
+// exist yet.
+func loadSyncState() (*SyncState, error) {
+	state := &SyncState{
+		path:    stateFile,
+		Devices: make(map[string]*DeviceState),
+	}
+
+	data, err := os.ReadFile(stateFile)
+	if errors.Is(err, os.ErrNotExist) {
+		state.buildOwners()
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, err
+	}
+	if state.Devices == nil {
+		state.Devices = make(map[string]*DeviceState)
+	}
+	state.buildOwners()
+	return state, nil
+}
+
+func (s *SyncState) buildOwners() {
+	s.owners = make(map[string]string)
+	for key, device := range s.Devices {
+		if device.Files == nil {
+			device.Files = make(map[string]FileState)
+		}
+		for localPath := range device.Files {
+			s.owners[localPath] = key
+		}
+	}
+}
+
+// Save writes the state file atomically.
+func (s *SyncState) Save() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := json.MarshalIndent(s, "", "\t")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// deviceLocked returns the state for device, creating it if needed.
+// Must be called with lock held.
+func (s *SyncState) deviceLocked(device Device) *DeviceState {
+	key := deviceKey(device)
+	ds, ok := s.Devices[key]
+	if !ok {
+		ds = &DeviceState{
+			RemotePath: device.RemotePath,
+			LocalPath:  filepath.ToSlash(device.LocalPath),
+			Files:      make(map[string]FileState),
+		}
+		s.Devices[key] = ds
+	}
+	return ds
+}
+
+// Owner returns the key of the device that owns localPath, if any.
+func (s *SyncState) Owner(localPath string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key, ok := s.owners[filepath.ToSlash(localPath)]
+	return key, ok
+}
+
+// RecordFile marks localPath as owned by device.
+func (s *SyncState) RecordFile(device Device, localPath string, file FileState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	localPath = filepath.ToSlash(localPath)
+	s.deviceLocked(device).Files[localPath] = file
+	s.owners[localPath] = deviceKey(device)
+}
+
+// ForgetFile drops localPath from device's owned files.
+func (s *SyncState) ForgetFile(device Device, localPath string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	localPath = filepath.ToSlash(localPath)
+	delete(s.deviceLocked(device).Files, localPath)
+	if s.owners[localPath] == deviceKey(device) {
+		delete(s.owners, localPath)
+	}
+}
+
+// File returns the recorded state of localPath, whichever device owns it.
+func (s *SyncState) File(localPath string) (FileState, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	localPath = filepath.ToSlash(localPath)
+	key, ok := s.owners[localPath]
+	if !ok {
+		return FileState{}, false
+	}
+	file, ok := s.Devices[key].Files[localPath]
+	return file, ok
+}
+
+// Requeue marks localPath for re-download on device's next sync, taking
+// ownership of it if it was not recorded yet.
+func (s *SyncState) Requeue(device Device, localPath string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	localPath = filepath.ToSlash(localPath)
+	ds := s.deviceLocked(device)
+	file := ds.Files[localPath]
+	file.Requeue = true
+	ds.Files[localPath] = file
+	s.owners[localPath] = deviceKey(device)
+}
+
+// Requeued reports whether localPath is queued for re-download.
+func (s *SyncState) Requeued(localPath string) bool {
+	file, ok := s.File(localPath)
+	return ok && file.Requeue
+}
+
+// MarkSynced records a complete, error-free sync of device.
+func (s *SyncState) MarkSynced(device Device, at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deviceLocked(device).LastSync = at
+}
+
+// LastSync returns when device last synced completely, or the zero time.
+func (s *SyncState) LastSync(device Device) time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ds, ok := s.Devices[deviceKey(device)]; ok {
+		return ds.LastSync
+	}
+	return time.Time{}
+}
+
+// OwnedFiles returns the local paths owned by device.
+func (s *SyncState) OwnedFiles(device Device) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ds, ok := s.Devices[deviceKey(device)]
+	if !ok {
+		return nil
+	}
+	paths := make([]string, 0, len(ds.Files))
+	for localPath := range ds.Files {
+		paths = append(paths, filepath.FromSlash(localPath))
+	}
+	return paths
+}
@@ -2,10 +2,17 @@ package main
 
 import (
 	"fmt"
+	"slices"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 )
 
+// throughputHistory is how far back the global speed samples reach, for the
+// throughput sparkline; speeds themselves are averaged over 10 seconds.
+const throughputHistory = time.Minute
+
 type speedSample struct {
 	t     time.Time
 	bytes int64
@@ -19,28 +26,74 @@ type SyncStats struct {
 	filesDeleted            int
 	filesSkipped            int
 	filesErrors             int
-	bytesDownloaded         int64   // Completed bytes including skipped (for transfer progress display)
-	bytesActuallyDownloaded int64   // Only actual downloads, for speed calculation
+	filesCancelled          int     // Downloads skipped with the skip hotkey
+	bytesSkipped            int64   // Listed size of up-to-date files, for the summary only
+	bytesActuallyDownloaded int64   // Completed downloads, for transfer progress and speed
 	bytesInProgress         []int64 // Current progress per slot
 	slotBytesBase           []int64 // Cumulative completed bytes per slot (for monotonic speed samples)
 	totalBytes              int64
 	startTime               time.Time
 	activities              []string        // Track current activity in each slot
-	activeSlots             int             // Number of activity slots to display (min of maxConcurrent and file count)
+	activeSlots             int             // Activity lines reserved when the live display starts (min of maxConcurrent and file count)
 	lastPrintedLines        int             // Number of lines printed in last Print() call (for cursor positioning)
-	maxConcurrent           int             // Maximum concurrent downloads
-	globalSpeedSamples      []speedSample   // Sliding window for global download speed
+	maxConcurrent           int             // Length of the per-slot slices: the most slots used so far
+	slots                   int             // Current concurrency limit
+	globalSpeedSamples      []speedSample   // Sliding window for global download speed and the sparkline
 	slotSpeedSamples        [][]speedSample // Sliding window per slot for per-file speed
-	draining                bool            // True when drain hotkey was pressed
+	draining                bool            // True once the run drains (hotkey, signal)
+	paused                  bool            // True while the pause hotkey holds downloads
+	aborting                bool            // True once the run aborts (hotkey, signal)
+	prompt                  string          // Hotkey input being typed, e.g. "skip slot 3_"
+	queue                   []queuedFile    // Downloads not started yet, in dispatch order
+	run                     runProgress     // Where this device sits in the whole run
+}
+
+// queuedFile is a download waiting for a slot.
+type queuedFile struct {
+	Name  string // path relative to the device
+	Bytes int64  // bytes left to download
+}
+
+// runProgress places a device within the whole run, for progress and ETA
+// across devices. Byte counts are the planned download sizes.
+type runProgress struct {
+	Device      int   // 1-based index of the device being synced
+	Devices     int   // number of devices in the run
+	BytesBefore int64 // bytes planned for the devices before this one
+	BytesTotal  int64 // bytes planned for the whole run
 }
 
 type SyncSummary struct {
-	FilesDownloaded int
-	FilesSkipped    int
-	FilesDeleted    int
-	FilesErrors     int
-	BytesDownloaded int64
-	BytesSkipped    int64
+	FilesDownloaded int   `json:"files_downloaded"`
+	FilesSkipped    int   `json:"files_skipped"`
+	FilesDeleted    int   `json:"files_deleted"`
+	FilesErrors     int   `json:"files_errors"`
+	FilesCancelled  int   `json:"files_cancelled"`
+	BytesDownloaded int64 `json:"bytes_downloaded"`
+	BytesSkipped    int64 `json:"bytes_skipped"`
+}
+
+// SyncProgress is a snapshot of a running sync for the event stream.
+type SyncProgress struct {
+	FilesChecked    int     `json:"files_checked"`
+	FilesTotal      int     `json:"files_total"`
+	FilesDownloaded int     `json:"files_downloaded"`
+	FilesSkipped    int     `json:"files_skipped"`
+	FilesDeleted    int     `json:"files_deleted"`
+	FilesErrors     int     `json:"files_errors"`
+	FilesCancelled  int     `json:"files_cancelled"`
+	Bytes           int64   `json:"bytes"`
+	TotalBytes      int64   `json:"total_bytes"`
+	BytesPerSecond  int64   `json:"bytes_per_second"`
+	ElapsedSeconds  float64 `json:"elapsed_seconds"`
+	ETASeconds      float64 `json:"eta_seconds,omitempty"`
+	Draining        bool    `json:"draining,omitempty"`
+	Paused          bool    `json:"paused,omitempty"`
+	Aborting        bool    `json:"aborting,omitempty"`
+	Concurrency     int     `json:"concurrency"`
+	RunBytes        int64   `json:"run_bytes"`
+	RunTotalBytes   int64   `json:"run_total_bytes"`
+	RunETASeconds   float64 `json:"run_eta_seconds,omitempty"`
 }
 
 func (s *SyncStats) Summary() SyncSummary {
@@ -51,8 +104,9 @@ func (s *SyncStats) Summary() SyncSummary {
 		FilesSkipped:    s.filesSkipped,
 		FilesDeleted:    s.filesDeleted,
 		FilesErrors:     s.filesErrors,
+		FilesCancelled:  s.filesCancelled,
 		BytesDownloaded: s.bytesActuallyDownloaded,
-		BytesSkipped:    s.bytesDownloaded - s.bytesActuallyDownloaded,
+		BytesSkipped:    s.bytesSkipped,
 	}
 }
 
@@ -64,7 +118,23 @@ func NewSyncStats(maxConcurrent int) *SyncStats {
 		activities:       make([]string, maxConcurrent),
 		slotSpeedSamples: make([][]speedSample, maxConcurrent),
 		maxConcurrent:    maxConcurrent,
+		slots:            maxConcurrent,
+	}
+}
+
+// SetSlots records a new concurrency limit, growing the per-slot slices if
+// it is the highest so far.
+func (s *SyncStats) SetSlots(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for s.maxConcurrent < n {
+		s.bytesInProgress = append(s.bytesInProgress, 0)
+		s.slotBytesBase = append(s.slotBytesBase, 0)
+		s.activities = append(s.activities, "")
+		s.slotSpeedSamples = append(s.slotSpeedSamples, nil)
+		s.maxConcurrent++
 	}
+	s.slots = n
 }
 
 func (s *SyncStats) SetDraining() {
@@ -73,6 +143,61 @@ func (s *SyncStats) SetDraining() {
 	s.draining = true
 }
 
+func (s *SyncStats) SetPaused(paused bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.paused = paused
+}
+
+func (s *SyncStats) SetAborting() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.aborting = true
+}
+
+func (s *SyncStats) SetPrompt(text string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.prompt = text
+}
+
+// SetQueue sets the downloads that will be started, in order.
+func (s *SyncStats) SetQueue(files []queuedFile) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.queue = files
+}
+
+// Dequeue removes the next download from the queue once it starts.
+func (s *SyncStats) Dequeue() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.queue) > 0 {
+		s.queue = s.queue[1:]
+	}
+}
+
+// Queue returns the downloads not started yet.
+func (s *SyncStats) Queue() []queuedFile {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.queue)
+}
+
+// Activities returns the activity line of every slot up to the current
+// limit, or of a busy slot above it; idle slots are "".
+func (s *SyncStats) Activities() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := s.slots
+	for i, activity := range s.activities {
+		if activity != "" {
+			n = max(n, i+1)
+		}
+	}
+	return slices.Clone(s.activities[:min(n, s.maxConcurrent)])
+}
+
 func (s *SyncStats) SetFilesTotal(n int) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -89,7 +214,6 @@ func (s *SyncStats) IncrementDownloaded(slot int, bytes int64) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	s.filesDownloaded++
-	s.bytesDownloaded += bytes
 	s.bytesActuallyDownloaded += bytes
 	if slot >= 0 && slot < s.maxConcurrent {
 		s.slotBytesBase[slot] += bytes
@@ -106,7 +230,13 @@ func (s *SyncStats) IncrementSkipped(bytes int64) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	s.filesSkipped++
-	s.bytesDownloaded += bytes
+	s.bytesSkipped += bytes
+}
+
+func (s *SyncStats) SetRun(run runProgress) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.run = run
 }
 
 func (s *SyncStats) IncrementErrors() {
@@ -115,16 +245,25 @@ func (s *SyncStats) IncrementErrors() {
 	s.filesErrors++
 }
 
+func (s *SyncStats) IncrementCancelled() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.filesCancelled++
+}
+
 func (s *SyncStats) SetTotalBytes(bytes int64) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	s.totalBytes = bytes
 }
 
+// AddTotalBytes corrects the device and run totals, e.g. once a download
+// turns out larger or smaller than its listed size.
 func (s *SyncStats) AddTotalBytes(bytes int64) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	s.totalBytes += bytes
+	s.run.BytesTotal += bytes
 }
 
 func (s *SyncStats) SetSlotProgress(slot int, bytes int64) {
@@ -211,7 +350,7 @@ func (s *SyncStats) getGlobalSpeedLocked() int64 {
 
 func (s *SyncStats) getTotalBytesTransferred() int64 {
 	// Must be called with lock held
-	total := s.bytesDownloaded
+	total := s.bytesActuallyDownloaded
 	for i := range s.maxConcurrent {
 		total += s.bytesInProgress[i]
 	}
@@ -234,50 +373,217 @@ func (s *SyncStats) ClearActivity(slot int) {
 	}
 }
 
-func (s *SyncStats) Print() {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	// Record global speed sample (download bytes only, not skipped)
+// recordSpeedSampleLocked adds a global speed sample (download bytes only,
+// not skipped). Must be called with lock held.
+func (s *SyncStats) recordSpeedSampleLocked() {
 	now := time.Now()
 	globalBytes := s.bytesActuallyDownloaded
 	for i := range s.maxConcurrent {
 		globalBytes += s.bytesInProgress[i]
 	}
 	s.globalSpeedSamples = append(s.globalSpeedSamples, speedSample{t: now, bytes: globalBytes})
-	cutoff := now.Add(-12 * time.Second)
+	cutoff := now.Add(-throughputHistory - time.Second)
 	for len(s.globalSpeedSamples) > 1 && s.globalSpeedSamples[0].t.Before(cutoff) {
 		s.globalSpeedSamples = s.globalSpeedSamples[1:]
 	}
+}
 
-	// Count active activity lines
-	activeCount := 0
-	for i := range s.activeSlots {
-		if s.activities[i] != "" {
-			activeCount++
+// throughputLocked splits the last throughputHistory into cols equal
+// intervals and returns the average download speed in each, oldest first,
+// or -1 for intervals before the first sample. Must be called with lock held.
+func (s *SyncStats) throughputLocked(cols int) []int64 {
+	samples := s.globalSpeedSamples
+	speeds := make([]int64, cols)
+	if len(samples) == 0 {
+		for i := range speeds {
+			speeds[i] = -1
+		}
+		return speeds
+	}
+	// bytesAt returns the cumulative bytes of the last sample at or before
+	// t, and false if t is before the first sample.
+	bytesAt := func(t time.Time) (int64, bool) {
+		i := sort.Search(len(samples), func(i int) bool { return samples[i].t.After(t) })
+		if i == 0 {
+			return 0, false
 		}
+		return samples[i-1].bytes, true
 	}
+	now := samples[len(samples)-1].t
+	step := throughputHistory / time.Duration(cols)
+	for i := range speeds {
+		start := now.Add(-throughputHistory + time.Duration(i)*step)
+		from, ok := bytesAt(start)
+		if !ok {
+			if start.Add(step).Before(samples[0].t) {
+				speeds[i] = -1
+				continue
+			}
+			from = samples[0].bytes
+		}
+		to, _ := bytesAt(start.Add(step))
+		speeds[i] = max(int64(float64(to-from)/step.Seconds()), 0)
+	}
+	return speeds
+}
 
-	// Calculate stats
-	totalTransferred := s.getTotalBytesTransferred()
-	elapsed := time.Since(s.startTime)
-	speed := s.getGlobalSpeedLocked()
+// progressLocked returns the bytes transferred so far, the percentage of
+// the total (empty if unknown), the current speed and the ETA (0 if
+// unknown). Must be called with lock held.
+func (s *SyncStats) progressLocked() (transferred int64, progressStr string, speed int64, eta time.Duration) {
+	transferred = s.getTotalBytesTransferred()
+	speed = s.getGlobalSpeedLocked()
+	progressStr = percentOf(transferred, s.totalBytes)
+	if s.totalBytes > 0 && speed > 0 && transferred < s.totalBytes {
+		remaining := s.totalBytes - transferred
+		eta = time.Duration(float64(remaining)/float64(speed)) * time.Second
+	}
+	return transferred, progressStr, speed, eta
+}
+
+// runProgressLocked returns the bytes done and planned for the whole run and
+// the run's ETA (0 if unknown), given this device's transferred bytes and
+// the current speed. Must be called with lock held.
+func (s *SyncStats) runProgressLocked(transferred, speed int64) (done, total int64, eta time.Duration) {
+	done = s.run.BytesBefore + min(transferred, s.totalBytes)
+	total = s.run.BytesTotal
+	if speed > 0 && done < total {
+		eta = time.Duration(float64(total-done)/float64(speed)) * time.Second
+	}
+	return done, total, eta
+}
 
-	progressStr := ""
-	if s.totalBytes > 0 {
-		percentage := float64(totalTransferred) / float64(s.totalBytes) * 100
-		progressStr = fmt.Sprintf(" (%.1f%%)", percentage)
+// percentOf formats done as a percentage of total, e.g. " (42.0%)", or ""
+// if total is 0.
+func percentOf(done, total int64) string {
+	if total <= 0 {
+		return ""
 	}
+	return fmt.Sprintf(" (%.1f%%)", float64(done)/float64(total)*100)
+}
+
+// ProgressLine returns the stats as a single line for plain output.
+func (s *SyncStats) ProgressLine() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.recordSpeedSampleLocked()
+	transferred, progressStr, speed, eta := s.progressLocked()
 
-	etaStr := ""
-	if s.totalBytes > 0 && speed > 0 && totalTransferred < s.totalBytes {
-		remaining := s.totalBytes - totalTransferred
-		etaStr = formatDuration(time.Duration(float64(remaining)/float64(speed)) * time.Second)
+	errors := fmt.Sprintf("%d errors", s.filesErrors)
+	if s.filesCancelled > 0 {
+		errors += fmt.Sprintf(", %d cancelled", s.filesCancelled)
+	}
+	line := fmt.Sprintf("Files %d/%d: %d downloaded, %d skipped, %d deleted, %s | %s / %s%s @ %s/s | %s",
+		s.filesChecked, s.filesTotal,
+		s.filesDownloaded, s.filesSkipped, s.filesDeleted, errors,
+		formatBytes(transferred), formatBytes(s.totalBytes), progressStr,
+		formatBytes(speed), formatDuration(time.Since(s.startTime)))
+	if eta > 0 && s.filesChecked < s.filesTotal {
+		line += ", ETA " + formatDuration(eta)
+	}
+	if s.run.Devices > 1 {
+		done, total, runETA := s.runProgressLocked(transferred, speed)
+		line += fmt.Sprintf(" | run %d/%d: %s / %s%s", s.run.Device, s.run.Devices, formatBytes(done), formatBytes(total), percentOf(done, total))
+		if runETA > 0 {
+			line += ", ETA " + formatDuration(runETA)
+		}
 	}
+	if s.paused {
+		line += " [paused]"
+	}
+	if s.draining {
+		line += " [draining]"
+	}
+	if s.aborting {
+		line += " [aborting]"
+	}
+	return line
+}
+
+// Progress returns a snapshot of the stats.
+func (s *SyncStats) Progress() SyncProgress {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.recordSpeedSampleLocked()
+	transferred, _, speed, eta := s.progressLocked()
+	if s.filesChecked >= s.filesTotal {
+		eta = 0
+	}
+	runDone, runTotal, runETA := s.runProgressLocked(transferred, speed)
+	return SyncProgress{
+		FilesChecked:    s.filesChecked,
+		FilesTotal:      s.filesTotal,
+		FilesDownloaded: s.filesDownloaded,
+		FilesSkipped:    s.filesSkipped,
+		FilesDeleted:    s.filesDeleted,
+		FilesErrors:     s.filesErrors,
+		FilesCancelled:  s.filesCancelled,
+		Bytes:           transferred,
+		TotalBytes:      s.totalBytes,
+		BytesPerSecond:  speed,
+		ElapsedSeconds:  time.Since(s.startTime).Seconds(),
+		ETASeconds:      eta.Seconds(),
+		Draining:        s.draining,
+		Paused:          s.paused,
+		Aborting:        s.aborting,
+		Concurrency:     s.slots,
+		RunBytes:        runDone,
+		RunTotalBytes:   runTotal,
+		RunETASeconds:   runETA.Seconds(),
+	}
+}
+
+// sparklineRowLocked renders the throughput of the last minute as a stats
+// panel row, one column per interval, with the peak speed. ok is false when
+// the terminal is too narrow for a useful sparkline. Must be called with
+// lock held.
+func (s *SyncStats) sparklineRowLocked() (row string, ok bool) {
+	const indent, maxCols, minCols = 10, 60, 10
+	// The peak label is sized for the widest speed so the row does not jump.
+	label := "  peak " + fmt.Sprintf("%11s/s", "")
+	cols := min(terminalWidth()-4-indent-len(label), maxCols)
+	if cols < minCols {
+		return "", false
+	}
+	speeds := s.throughputLocked(cols)
+	var peak int64
+	for _, speed := range speeds {
+		peak = max(peak, speed)
+	}
+	return fmt.Sprintf("%s%s%s%s  %speak %s/s%s", strings.Repeat(" ", indent),
+		colorCyan, sparkline(speeds), colorReset,
+		colorDim, formatBytes(peak), colorReset), true
+}
+
+// PanelRows returns the rows of the stats panel: file counts, transfer,
+// speed, time and ETA, and progress across the run.
+func (s *SyncStats) PanelRows() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.recordSpeedSampleLocked()
+	return s.panelRowsLocked()
+}
+
+// panelRowsLocked builds the stats panel rows. Must be called with lock held.
+func (s *SyncStats) panelRowsLocked() []string {
+	totalTransferred, progressStr, speed, eta := s.progressLocked()
+	elapsed := time.Since(s.startTime)
 
 	drainingStr := ""
+	if s.filesCancelled > 0 {
+		drainingStr += fmt.Sprintf("  %d cancelled", s.filesCancelled)
+	}
+	if s.paused {
+		drainingStr += fmt.Sprintf("  %s[ paused ]%s", colorYellow, colorReset)
+	}
 	if s.draining {
-		drainingStr = fmt.Sprintf("  %s[ draining ]%s", colorYellow, colorReset)
+		drainingStr += fmt.Sprintf("  %s[ draining ]%s", colorYellow, colorReset)
+	}
+	if s.aborting {
+		drainingStr += fmt.Sprintf("  %s[ aborting ]%s", colorRed, colorReset)
+	}
+	if s.prompt != "" {
+		drainingStr += fmt.Sprintf("  %s[ %s ]%s", colorBold, s.prompt, colorReset)
 	}
 
 	// Build stats panel rows
@@ -293,13 +599,47 @@ func (s *SyncStats) Print() {
 		fmt.Sprintf("%sTransfer:%s %s%s%s / %s%s",
 			colorBold, colorReset,
 			colorCyan, formatBytes(totalTransferred), colorReset,
-			formatBytesIfKnown(s.totalBytes), progressStr),
-		fmt.Sprintf("          %s@ %s/s%s", colorCyan, formatBytes(speed), colorReset),
+			formatBytes(s.totalBytes), progressStr),
+		fmt.Sprintf("          %s@ %s/s%s  %s%d slot(s)%s", colorCyan, formatBytes(speed), colorReset, colorDim, s.slots, colorReset),
+	}
+	if progressBars {
+		if row, ok := s.sparklineRowLocked(); ok {
+			rows = append(rows, row)
+		}
+	}
+	rows = append(rows,
 		fmt.Sprintf("%sTime:%s     %s%s%s",
 			colorBold, colorReset, colorBlue, formatDuration(elapsed), colorReset),
+	)
+	if eta > 0 {
+		rows = append(rows, fmt.Sprintf("          %sETA %s%s", colorBlue, formatDuration(eta), colorReset))
+	}
+	if s.run.Devices > 1 {
+		done, total, runETA := s.runProgressLocked(totalTransferred, speed)
+		row := fmt.Sprintf("%sRun:%s      device %d/%d  %s%s%s / %s%s",
+			colorBold, colorReset, s.run.Device, s.run.Devices,
+			colorCyan, formatBytes(done), colorReset, formatBytes(total), percentOf(done, total))
+		if runETA > 0 {
+			row += fmt.Sprintf("  %sETA %s%s", colorBlue, formatDuration(runETA), colorReset)
+		}
+		rows = append(rows, row)
 	}
-	if etaStr != "" {
-		rows = append(rows, fmt.Sprintf("          %sETA %s%s", colorBlue, etaStr, colorReset))
+	return rows
+}
+
+func (s *SyncStats) Print() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.recordSpeedSampleLocked()
+	rows := s.panelRowsLocked()
+
+	// Count active activity lines
+	activeCount := 0
+	for _, activity := range s.activities {
+		if activity != "" {
+			activeCount++
+		}
 	}
 
 	// linesToPrint: activity lines + empty line + top border + content rows + bottom border (no trailing \n)
@@ -314,9 +654,9 @@ func (s *SyncStats) Print() {
 	}
 
 	// Print non-empty activity lines
-	for i := range s.activeSlots {
-		if s.activities[i] != "" {
-			fmt.Printf("%s\n", s.activities[i])
+	for _, activity := range s.activities {
+		if activity != "" {
+			fmt.Printf("%s\n", activity)
 		}
 	}
 
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+)
+
+// fileStatus is how a remote file or local file compares between the two
+// sides, as reported by `myrientor status`.
+type fileStatus int
+
+const (
+	statusNew      fileStatus = iota // on the remote, never synced
+	statusChanged                    // present locally but differs from the remote
+	statusMissing                    // synced before but no longer present locally
+	statusObsolete                   // local file no longer on the remote
+	statusUpToDate                   // present locally and current
+	statusCount
+)
+
+var statusLabels = [statusCount]struct {
+	symbol, name string
+}{
+	statusNew:      {"+", "New"},
+	statusChanged:  {"~", "Changed"},
+	statusMissing:  {"!", "Missing"},
+	statusObsolete: {"-", "Obsolete"},
+	statusUpToDate: {"=", "Up to date"},
+}
+
+// color returns the color a status is shown in. It is looked up when
+// printing, as plain output blanks the colors after initialization.
+func (s fileStatus) color() string {
+	switch s {
+	case statusNew:
+		return colorGreen
+	case statusChanged:
+		return colorCyan
+	case statusMissing:
+		return colorYellow
+	case statusObsolete:
+		return colorRed
+	}
+	return colorDim
+}
+
+// statusEntry is one file in a status category.
+type statusEntry struct {
+	Path string
+	Size int64
+}
+
+// deviceStatus is the result of comparing one device with its remote.
+type deviceStatus struct {
+	Files  [statusCount][]statusEntry
+	Errors []string
+}
+
+// runStatusCommand implements `myrientor status [device…]`: crawl the remote
+// listing and compare it against the local tree without downloading or
+// deleting anything.
+func runStatusCommand(args []string) int {
+	fs := flag.NewFlagSet("status", flag.ExitOnError)
+	flags := registerFlags(fs)
+	listFiles := fs.Bool("files", false, "List the files in each category, not just counts")
+	fs.Parse(args)
+
+	cfg, err := loadConfig(flags)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s✗ Config error: %v%s\n", colorRed, err, colorReset)
+		return exitConfig
+	}
+	state, err := loadSyncState()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s✗ Error reading state file %s: %v%s\n", colorRed, stateFile, err, colorReset)
+		return exitConfig
+	}
+
+	devices, err := cfg.MatchDevices(fs.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s✗ %v%s\n", colorRed, err, colorReset)
+		return exitConfig
+	}
+
+	client := newQuickClient()
+	var totals deviceStatus
+	for i, device := range devices {
+		fmt.Printf("\n%s\n", devicePanel(i+1, len(devices), "Status", device.RemotePath))
+
+		settings, err := cfg.DeviceSettings(device)
+		if err != nil {
+			fmt.Printf("%s✗ Invalid settings: %v%s\n", colorRed, err, colorReset)
+			totals.Errors = append(totals.Errors, err.Error())
+			continue
+		}
+
+		statusLine("%s  Scanning...%s", colorDim, colorReset)
+		plan, err := planDevice(client, device, settings, state, nil, func(subDir string) {
+			label := "root"
+			if subDir != "" {
+				label = subDir
+			}
+			statusLine("%s  Scanning: %s%s", colorDim, fitInTerminal(label, 13), colorReset)
+		})
+		clearStatusLine()
+		if err != nil {
+			fmt.Printf("%s✗ %v%s\n", colorRed, err, colorReset)
+			totals.Errors = append(totals.Errors, err.Error())
+			continue
+		}
+
+		status := compareDevice(client, device, settings, plan, state)
+		printDeviceStatus(status, *listFiles)
+		for category := range statusCount {
+			totals.Files[category] = append(totals.Files[category], status.Files[category]...)
+		}
+		totals.Errors = append(totals.Errors, status.Errors...)
+	}
+
+	fmt.Println()
+	fmt.Println(panelTopLabeled("STATUS"))
+	for category := range statusCount {
+		label := statusLabels[category]
+		count, size := statusTotals(totals.Files[category])
+		fmt.Println(panelLine(fmt.Sprintf("%s%s %-11s%s %6d  %s",
+			category.color(), label.symbol, label.name, colorReset, count, formatBytes(size))))
+	}
+	fmt.Println(panelLine(fmt.Sprintf("%sDevices:%s  %d checked  %s%d errors%s",
+		colorBold, colorReset, len(devices), colorRed, len(totals.Errors), colorReset)))
+	fmt.Println(panelBottom())
+
+	if len(totals.Errors) > 0 {
+		return exitErrors
+	}
+	return exitOK
+}
+
+// compareDevice classifies every planned file using the same checks as a
+// sync (shouldDownload), plus the files cleanup would delete. Under
+// delete_policy keep cleanup deletes nothing, so nothing is obsolete.
+func compareDevice(client *http.Client, device Device, settings SyncSettings, plan *devicePlan, state *SyncState) deviceStatus {
+	var (
+		status deviceStatus
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+	)
+	add := func(category fileStatus, path string, size int64) {
+		mu.Lock()
+		defer mu.Unlock()
+		status.Files[category] = append(status.Files[category], statusEntry{Path: path, Size: size})
+	}
+
+	key := deviceKey(device)
+	sem := make(chan struct{}, settings.MaxConcurrent)
+	for _, task := range plan.Tasks {
+		if _, err := os.Stat(task.LocalPath); os.IsNotExist(err) {
+			if owner, ok := state.Owner(task.LocalPath); ok && owner == key {
+				add(statusMissing, task.LocalPath, task.Size)
+			} else {
+				add(statusNew, task.LocalPath, task.Size)
+			}
+			continue
+		}
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(task syncTask) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			needsDownload, _, err := shouldDownload(client, remoteFileURL(plan.RemoteURL, task.FileInfo), task.LocalPath)
+			switch {
+			case err != nil:
+				mu.Lock()
+				status.Errors = append(status.Errors, fmt.Sprintf("%s: %v", task.LocalPath, err))
+				mu.Unlock()
+			case needsDownload:
+				add(statusChanged, task.LocalPath, task.Size)
+			default:
+				add(statusUpToDate, task.LocalPath, task.Size)
+			}
+		}(task)
+	}
+	wg.Wait()
+	sort.Strings(status.Errors)
+
+	if settings.DeleteObsolete {
+		obsolete, err := plan.ObsoleteFiles(device, state)
+		if err != nil {
+			status.Errors = append(status.Errors, err.Error())
+		}
+		for _, path := range obsolete {
+			var size int64
+			if info, err := os.Stat(path); err == nil {
+				size = info.Size()
+			}
+			add(statusObsolete, path, size)
+		}
+	}
+	for _, collision := range plan.Collisions {
+		status.Errors = append(status.Errors, "collision: "+collision)
+	}
+
+	// The checks finish in any order; list files by path.
+	for category := range statusCount {
+		sort.Slice(status.Files[category], func(i, j int) bool {
+			return status.Files[category][i].Path < status.Files[category][j].Path
+		})
+	}
+	return status
+}
+
+func statusTotals(entries []statusEntry) (count int, size int64) {
+	for _, entry := range entries {
+		size += entry.Size
+	}
+	return len(entries), size
+}
+
+// printDeviceStatus prints per-category counts for one device, optionally
+// followed by the files in each category.
+func printDeviceStatus(status deviceStatus, listFiles bool) {
+	for category := range statusCount {
+		label := statusLabels[category]
+		count, size := statusTotals(status.Files[category])
+		fmt.Printf("  %s%s %-11s%s %6d  %s\n", category.color(), label.symbol, label.name, colorReset, count, formatBytes(size))
+		if listFiles && category != statusUpToDate {
+			for _, entry := range status.Files[category] {
+				fmt.Printf("      %s%s%s %s\n", category.color(), label.symbol, colorReset, entry.Path)
+			}
+		}
+	}
+	for _, msg := range status.Errors {
+		fmt.Printf("  %s✗ %s%s\n", colorRed, msg, colorReset)
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
 	"net"
@@ -10,6 +11,7 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -18,277 +20,382 @@ import (
 const (
 	downloadMaxRetries   = 3
 	downloadStallTimeout = 30 * time.Second
+	downloadBufferSize   = 32 * 1024 // bytes per read, and so per rate limiter wait
+
+	// partSuffix marks a download in progress; the file is renamed to its
+	// final name once complete.
+	partSuffix = ".part"
+)
+
+// Reasons a download is cancelled, as returned by downloadFile.
+var (
+	errStalled = errors.New("download stalled")
+	errSkipped = errors.New("skipped by user")
+	errAborted = errors.New("sync aborted")
 )
 
+// downloadOptions tunes a single file download.
+type downloadOptions struct {
+	stallTimeout time.Duration // cancel and retry if no data arrives for this long
+	limiter      *rateLimiter  // shared bandwidth cap; nil means unlimited
+	pause        *pauseGate    // shared pause hotkey state; nil never pauses
+
+	// onRetry, if set, is called before each retry with the number of the
+	// attempt that failed (1-based) and its error.
+	onRetry func(attempt int, err error)
+}
+
 type FileInfo struct {
 	Name   string
 	Size   int64
 	SubDir string // relative subdirectory using / separator, URL-decoded (empty for root)
 }
 
-func syncDirectory(device Device, baseURL string, maxConcurrent int, errLog *ErrorLogger) (drained bool, summary SyncSummary, err error) {
-	stats := NewSyncStats(maxConcurrent)
-
-	// Client for quick operations (HEAD requests, directory listings)
-	// with TLS verification disabled (--no-check-certificate)
-	quickClient := &http.Client{
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		},
-		Timeout: 30 * time.Second,
+// RelPath returns the file's path relative to the device's remote path.
+func (f FileInfo) RelPath() string {
+	if f.SubDir == "" {
+		return f.Name
 	}
+	return f.SubDir + "/" + f.Name
+}
 
-	// Client for downloads - connection timeouts but no overall timeout for large files
-	// with TLS verification disabled (--no-check-certificate)
-	downloadClient := &http.Client{
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-			DialContext: (&net.Dialer{
-				Timeout:   30 * time.Second,
-				KeepAlive: 30 * time.Second,
-			}).DialContext,
-			TLSHandshakeTimeout: 10 * time.Second,
-			IdleConnTimeout:     90 * time.Second,
-			MaxIdleConns:        100,
-			MaxIdleConnsPerHost: maxConcurrent,
-		},
-		Timeout: 0,
+// fileInfoFromRelPath is the inverse of RelPath.
+func fileInfoFromRelPath(relPath string, size int64) FileInfo {
+	subDir, name := "", relPath
+	if i := strings.LastIndexByte(relPath, '/'); i >= 0 {
+		subDir, name = relPath[:i], relPath[i+1:]
 	}
+	return FileInfo{Name: name, Size: size, SubDir: subDir}
+}
 
-	// Get directory listing, showing scanning progress for each directory entered.
-	remoteURL := baseURL + device.RemotePath
-	fmt.Printf("%s  Scanning...%s", colorDim, colorReset)
-	filesInfo, err := getDirectoryListing(quickClient, remoteURL, func(subDir string) {
-		label := "root"
-		if subDir != "" {
-			label = subDir
-		}
-		fmt.Printf("\r%s  Scanning: %s%s\033[K", colorDim, fitInTerminal(label, 13), colorReset)
-	})
-	fmt.Printf("\r\033[K") // clear scanning line
-	if err != nil {
-		return false, SyncSummary{}, fmt.Errorf("failed to get directory listing: %w", err)
+// syncTask is a remote file together with the local path it is stored at.
+type syncTask struct {
+	FileInfo
+	LocalPath string
+}
+
+// syncDirectory carries out a device's plan: it deletes obsolete files,
+// records the files the planning phase found up to date and downloads the
+// rest. run places the device within the whole run for the progress display.
+// ctl is the run's drain and abort state: the drain hotkey and low free space
+// drain it, the abort hotkey aborts it, and either stops the device.
+func syncDirectory(device Device, settings SyncSettings, plan *devicePlan, run runProgress, ctl *runControl, state *SyncState, failures *FailureLog, logger *Logger, report *deviceReport) (drained bool, summary SyncSummary, err error) {
+	maxConcurrent := settings.MaxConcurrent
+	stats := NewSyncStats(maxConcurrent)
+	dlOpts := downloadOptions{
+		stallTimeout: settings.StallTimeout,
+		limiter:      newRateLimiter(settings.MaxSpeed),
+		pause:        newPauseGate(),
 	}
 
-	// Local directory mirrors the remote path structure under local_path.
-	localDir := filepath.Join(device.LocalPath, device.RemotePath)
+	downloadClient := newDownloadClient(maxConcurrent)
+
+	// Local root is where the layout places this device's files; by default
+	// it mirrors the remote path structure under local_path.
+	localDir := plan.LocalDir
 	if err := os.MkdirAll(localDir, 0755); err != nil {
 		return false, SyncSummary{}, fmt.Errorf("failed to create local directory: %w", err)
 	}
 
-	// Build sync list and remote file set for cleanup.
-	// getDirectoryListing already excludes systeminfo.txt and directories.
-	var filesToSync []FileInfo
-	remoteFileSet := make(map[string]bool)
-	totalSize := int64(0)
-
-	for _, fileInfo := range filesInfo {
-		filesToSync = append(filesToSync, fileInfo)
-		relKey := fileInfo.Name
-		if fileInfo.SubDir != "" {
-			relKey = fileInfo.SubDir + "/" + fileInfo.Name
-		}
-		remoteFileSet[relKey] = true
-		totalSize += fileInfo.Size
+	for _, collision := range plan.Collisions {
+		stats.IncrementErrors()
+		logger.Error("path collision", nil, "path", localDir, "collision", collision)
 	}
 
-	// Set total bytes for progress tracking
-	stats.SetTotalBytes(totalSize)
+	// Progress counts only what is left to transfer, so files found up to
+	// date or partly downloaded already do not inflate the speed or ETA.
+	stats.SetTotalBytes(plan.DownloadSize)
+	stats.SetRun(run)
 
-	// Set total file count and active slots
-	stats.SetFilesTotal(len(filesToSync))
-	stats.activeSlots = min(maxConcurrent, len(filesToSync))
+	// Set total file count, the download queue and active slots
+	stats.SetFilesTotal(len(plan.Checks))
+	var queue []queuedFile
+	for _, check := range plan.Checks {
+		if check.Download && check.Err == nil {
+			queue = append(queue, queuedFile{Name: check.RelPath(), Bytes: check.Bytes()})
+		}
+	}
+	stats.SetQueue(queue)
+	stats.activeSlots = min(maxConcurrent, plan.DownloadCount)
 	if stats.activeSlots == 0 {
 		stats.activeSlots = 1 // At least 1 slot for stats display
 	}
 
-	// Clean up obsolete local files
-	if err := cleanupObsoleteFiles(localDir, remoteFileSet, stats, errLog); err != nil {
-		errLog.Log("%s: error cleaning obsolete files: %v", localDir, err)
-	}
-
-	// Sync files with concurrency control
-	sem := make(chan struct{}, maxConcurrent)
-	slotChan := make(chan int, maxConcurrent)
+	reporter := teeReporter{newSyncReporter(device), report}
 
-	// Initialize slot pool
-	for i := range maxConcurrent {
-		slotChan <- i
+	// Clean up obsolete local files unless the delete policy forbids it
+	if settings.DeleteObsolete && !settings.RetryFailed {
+		if err := cleanupObsoleteFiles(device, plan, state, stats, reporter, logger); err != nil {
+			logger.Error("cleaning obsolete files failed", err, "path", localDir)
+		}
 	}
 
-	var wg sync.WaitGroup
+	// Sync files with concurrency control; the hotkeys can resize the pool,
+	// cancel the download in one slot, or abort them all.
+	pool := newSlotPool(maxConcurrent)
+	ctx := ctl.Context()
 
-	// Start stats printer
-	stopStats := make(chan struct{})
+	var wg sync.WaitGroup
 
-	// Print initial empty lines for activities and stats
-	initialLines := stats.activeSlots + 6
-	for range initialLines {
-		fmt.Println()
-	}
-	stats.lastPrintedLines = initialLines
+	// Start progress output and the drain listeners
+	reporter.Start(stats)
+	stopListeners := make(chan struct{})
+	drainCh, waitHotkey := listenForDrain(stopListeners, hotkeyActions{
+		pause: func() {
+			stats.SetPaused(dlOpts.pause.Toggle())
+		},
+		resize: func(delta int) {
+			limit := pool.Resize(delta)
+			stats.SetSlots(limit)
+			logger.Info("concurrency changed", "path", localDir, "max_concurrent", limit)
+		},
+		skip: func(slot int) {
+			if pool.Cancel(slot-1, errSkipped) {
+				logger.Info("skip requested", "path", localDir, "slot", slot)
+			}
+		},
+		prompt: stats.SetPrompt,
+		abort:  ctl.Abort,
+		scroll: tui.Scroll,
+	})
+	lowSpaceCh := watchFreeSpace(localDir, settings.MinFreeSpace, stopListeners)
+	draining, lowSpace := false, false
 
+	// Show a drain or abort in the progress display, whether it came from a
+	// hotkey or a signal.
 	go func() {
-		ticker := time.NewTicker(100 * time.Millisecond)
-		defer ticker.Stop()
-		for {
-			select {
-			case <-ticker.C:
-				stats.Print()
-			case <-stopStats:
-				return
-			}
+		select {
+		case <-ctl.Draining():
+			stats.SetDraining()
+		case <-stopListeners:
+			return
+		}
+		select {
+		case <-ctx.Done():
+			stats.SetAborting()
+		case <-stopListeners:
 		}
 	}()
 
-	drainCh, waitHotkey := listenForDrain(stopStats)
-	draining := false
+	for _, check := range plan.Checks {
+		file := check.syncTask
+		remoteFile := remoteFileURL(plan.RemoteURL, file.FileInfo)
+
+		// The planning phase already checked every file; only downloads
+		// need a slot.
+		if check.Err != nil {
+			stats.IncrementChecked()
+			stats.IncrementErrors()
+			failures.Record(device, file, remoteFile, check.Err)
+			reporter.FileFailed(file.RelPath(), check.Err)
+			logger.Error("check failed", check.Err, "file", file.RelPath(), "path", file.LocalPath, "url", remoteFile)
+			continue
+		}
+		reporter.FileChecked(file.RelPath(), check.Download, check.Elapsed)
+		logger.Debug("checked", "file", file.RelPath(), "needs_download", check.Download)
+		if !check.Download {
+			stats.IncrementChecked()
+			stats.IncrementSkipped(file.Size)
+			reporter.FileSkipped(file.RelPath(), file.Size)
+			if info, err := os.Stat(file.LocalPath); err == nil {
+				state.RecordFile(device, file.LocalPath, FileState{Remote: file.RelPath(), Size: info.Size()})
+			}
+			failures.Clear(file.LocalPath)
+			continue
+		}
 
-	for _, fileInfo := range filesToSync {
 		select {
 		case <-drainCh:
 			draining = true
-			stats.SetDraining()
+		case <-lowSpaceCh:
+			draining, lowSpace = true, true
+		case <-ctl.Draining():
+			draining = true
 		default:
 		}
 		if draining {
+			ctl.Drain()
 			break
 		}
 
-		// Acquire semaphore slot; also watch for drain signal while blocked.
-		select {
-		case sem <- struct{}{}:
-		case <-drainCh:
-			draining = true
-			stats.SetDraining()
+		// Acquire a slot; also watch for drain signals while blocked.
+		slot, ok, changed := pool.TryAcquire()
+		for !ok && !draining {
+			select {
+			case <-changed:
+				slot, ok, changed = pool.TryAcquire()
+			case <-drainCh:
+				draining = true
+			case <-lowSpaceCh:
+				draining, lowSpace = true, true
+			case <-ctl.Draining():
+				draining = true
+			}
 		}
 		if draining {
+			ctl.Drain()
 			break
 		}
 
+		stats.Dequeue()
 		wg.Add(1)
-		slot := <-slotChan // Get available slot
-
-		go func(file FileInfo, activitySlot int) {
+		go func(file syncTask, remoteFile string, partial int64, activitySlot int) {
 			defer wg.Done()
 			defer func() {
-				<-sem // Release semaphore
 				stats.ClearActivity(activitySlot)
-				slotChan <- activitySlot // Return slot
+				pool.Release(activitySlot) // Return slot
 			}()
+			fileCtx, cancelFile := context.WithCancelCause(ctx)
+			defer cancelFile(nil)
+			pool.Bind(activitySlot, cancelFile)
 
 			stats.IncrementChecked()
 
-			// Build remote URL: re-encode each SubDir segment, then append filename.
-			var escapedSubDir strings.Builder
-			for seg := range strings.SplitSeq(file.SubDir, "/") {
-				if seg != "" {
-					escapedSubDir.WriteString(url.PathEscape(seg) + "/")
-				}
-			}
-			remoteFile := remoteURL + escapedSubDir.String() + url.PathEscape(file.Name)
-
-			// Build local path, creating the subdirectory if needed.
-			fileLocalDir := filepath.Join(localDir, filepath.FromSlash(file.SubDir))
+			// Create the local file's directory if needed.
+			localFile := file.LocalPath
+			fileLocalDir := filepath.Dir(localFile)
 			if err := os.MkdirAll(fileLocalDir, 0755); err != nil {
 				stats.IncrementErrors()
-				errLog.Log("%s: failed to create directory: %v", fileLocalDir, err)
+				failures.Record(device, file, remoteFile, err)
+				reporter.FileFailed(file.RelPath(), err)
+				logger.Error("creating directory failed", err, "file", file.RelPath(), "path", fileLocalDir)
 				return
 			}
-			localFile := filepath.Join(fileLocalDir, file.Name)
 
-			// Check if file needs downloading
-			stats.SetActivity(activitySlot, activityLine(colorBlue+"→ Checking:"+colorReset+" ", 12, file.Name, ""))
-			needsDownload, err := shouldDownload(quickClient, remoteFile, localFile)
-			if err != nil {
-				stats.IncrementErrors()
-				stats.ClearActivity(activitySlot)
-				errLog.Log("%s: error checking %s: %v", fileLocalDir, file.Name, err)
-				return
+			// Progress callback for this file. A resumed download starts at
+			// the partial size, which was never counted as left to transfer.
+			onProgress := func(written, total int64) {
+				stats.SetSlotProgress(activitySlot, max(written-partial, 0))
+				speed := stats.GetSlotSpeed(activitySlot)
+				prefix, prefixCols := slotPrefix(activitySlot, colorCyan+"↓"+colorReset)
+				if progressBars && total > 0 {
+					stats.SetActivity(activitySlot, progressBarLine(prefix, prefixCols, file.Name, written, total, speed))
+					return
+				}
+				var suffix string
+				if total > 0 {
+					pct := float64(written) / float64(total) * 100
+					suffix = fmt.Sprintf("%.0f%% %s/%s @ %s/s", pct, formatBytes(written), formatBytes(total), formatBytes(speed))
+				} else {
+					suffix = fmt.Sprintf("%s @ %s/s", formatBytes(written), formatBytes(speed))
+				}
+				stats.SetActivity(activitySlot, activityLine(prefix, prefixCols, file.Name, suffix))
 			}
 
-			if needsDownload {
-				// Progress callback for this file
-				onProgress := func(written, total int64) {
-					stats.SetSlotProgress(activitySlot, written)
-					speed := stats.GetSlotSpeed(activitySlot)
-					var suffix string
-					if total > 0 {
-						pct := float64(written) / float64(total) * 100
-						suffix = fmt.Sprintf("%.0f%% %s/%s @ %s/s", pct, formatBytes(written), formatBytes(total), formatBytes(speed))
-					} else {
-						suffix = fmt.Sprintf("%s @ %s/s", formatBytes(written), formatBytes(speed))
-					}
-					stats.SetActivity(activitySlot, activityLine(colorCyan+"↓"+colorReset+" ", 2, file.Name, suffix))
-				}
+			fileOpts := dlOpts
+			fileOpts.onRetry = func(attempt int, err error) {
+				logger.Warn("download attempt failed, retrying", err, "file", file.RelPath(), "url", remoteFile, "attempt", attempt)
+			}
 
-				bytes, err := downloadFile(downloadClient, remoteFile, localFile, onProgress)
-				stats.ClearSlotProgress(activitySlot) // Clear in-progress bytes when done
-				if err != nil {
-					stats.IncrementErrors()
-					stats.ClearActivity(activitySlot)
-					errLog.Log("%s: error downloading %s: %v", fileLocalDir, file.Name, err)
-					return
-				}
-				stats.IncrementDownloaded(activitySlot, bytes)
-				suffix := fmt.Sprintf("(%s)", formatBytes(bytes))
-				stats.SetActivity(activitySlot, activityLine(colorGreen+"✓"+colorReset+" ", 2, file.Name, suffix))
-			} else {
-				stats.IncrementSkipped(file.Size)
+			downloadStart := time.Now()
+			bytes, err := downloadFile(fileCtx, downloadClient, remoteFile, localFile, fileOpts, onProgress)
+			stats.ClearSlotProgress(activitySlot) // Clear in-progress bytes when done
+			if errors.Is(err, errAborted) {
+				// Not a failure: the partial file resumes on the next run.
+				logger.Info("download aborted", "file", file.RelPath(), "path", localFile, "bytes", bytes)
+				return
+			}
+			if errors.Is(err, errSkipped) {
+				// Not a failure either: the file is still wanted, so the
+				// next run downloads it, resuming the partial file.
+				stats.IncrementCancelled()
+				reporter.FileCancelled(file.RelPath())
+				logger.Warn("download skipped", err, "file", file.RelPath(), "path", localFile, "url", remoteFile, "bytes", bytes)
+				return
+			}
+			if err != nil {
+				stats.IncrementErrors()
 				stats.ClearActivity(activitySlot)
+				failures.Record(device, file, remoteFile, err)
+				reporter.FileFailed(file.RelPath(), err)
+				logger.Error("download failed", err, "file", file.RelPath(), "path", localFile, "url", remoteFile, "attempt", downloadMaxRetries+1)
+				return
 			}
-		}(fileInfo, slot)
+			transferred := max(bytes-partial, 0)
+			stats.AddTotalBytes(transferred - max(file.Size-partial, 0))
+			stats.IncrementDownloaded(activitySlot, transferred)
+			state.RecordFile(device, localFile, FileState{Remote: file.RelPath(), Size: bytes})
+			failures.Clear(localFile)
+			reporter.FileDownloaded(file.RelPath(), bytes, time.Since(downloadStart))
+			logger.Audit("downloaded", "file", file.RelPath(), "path", localFile, "url", remoteFile,
+				"bytes", bytes, "duration_ms", time.Since(downloadStart).Milliseconds())
+			suffix := fmt.Sprintf("(%s)", formatBytes(bytes))
+			prefix, prefixCols := slotPrefix(activitySlot, colorGreen+"✓"+colorReset)
+			stats.SetActivity(activitySlot, activityLine(prefix, prefixCols, file.Name, suffix))
+		}(file, remoteFile, check.Partial, slot)
 	}
 
 	wg.Wait()
-	close(stopStats)
+	close(stopListeners)
 	waitHotkey() // Restore terminal before final print
+	aborted := ctl.Aborted()
+	draining = draining || aborted
+
+	if lowSpace {
+		logger.Warn("free space below min_free_space, queue drained", nil, "path", localDir, "min_free_space", formatBytes(settings.MinFreeSpace))
+	}
+
+	summary = stats.Summary()
+	if !draining && summary.FilesErrors == 0 && summary.FilesCancelled == 0 && !settings.RetryFailed {
+		state.MarkSynced(device, time.Now())
+	}
+	if err := state.Save(); err != nil {
+		logger.Error("saving state failed", err, "path", stateFile)
+	}
+	if err := failures.Save(); err != nil {
+		logger.Error("saving failure log failed", err, "path", failedFile)
+	}
 
 	// Print final stats
-	stats.Print()
-	fmt.Printf("\n%s✓ Sync complete%s\n", colorGreen, colorReset)
+	reporter.Stop(stats)
+	switch {
+	case aborted:
+		fmt.Printf("\n%s⚠ Sync aborted; partial downloads resume on the next run%s\n", colorYellow, colorReset)
+	case lowSpace:
+		fmt.Printf("\n%s⚠ Free space below %s, stopped early%s\n", colorYellow, formatBytes(settings.MinFreeSpace), colorReset)
+	default:
+		fmt.Printf("\n%s✓ Sync complete%s\n", colorGreen, colorReset)
+	}
 	fmt.Println()
 
-	return draining, stats.Summary(), nil
+	if aborted {
+		return true, summary, errAborted
+	}
+	return draining, summary, nil
 }
 
-func cleanupObsoleteFiles(localDir string, remoteFiles map[string]bool, stats *SyncStats, errLog *ErrorLogger) error {
-	deletedCount := 0
-
-	err := filepath.Walk(localDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return nil // skip inaccessible paths
-		}
-		if info.IsDir() {
-			return nil
-		}
-
-		relPath, err := filepath.Rel(localDir, path)
-		if err != nil {
-			return nil
-		}
-		relPath = filepath.ToSlash(relPath)
-
-		if filepath.Base(relPath) == "systeminfo.txt" {
-			return nil
-		}
-
-		if !remoteFiles[relPath] {
-			if err := os.Remove(path); err != nil {
-				stats.IncrementErrors()
-				errLog.Log("%s: error removing %s: %v", localDir, path, err)
-			} else {
-				stats.IncrementDeleted()
-				deletedCount++
-			}
-		}
-		return nil
-	})
+// slotPrefix labels an activity line with its 1-based slot number, which
+// the skip hotkey selects, followed by a one-column icon. It returns the
+// prefix and its visible width for activityLine.
+func slotPrefix(slot int, icon string) (string, int) {
+	number := strconv.Itoa(slot + 1)
+	return colorDim + number + colorReset + " " + icon + " ", len(number) + 3
+}
 
+// cleanupObsoleteFiles removes the local files the plan marks as obsolete.
+func cleanupObsoleteFiles(device Device, plan *devicePlan, state *SyncState, stats *SyncStats, reporter syncReporter, logger *Logger) error {
+	obsolete, err := plan.ObsoleteFiles(device, state)
 	if err != nil {
 		return err
 	}
 
+	deletedCount := 0
+	for _, path := range obsolete {
+		err := os.Remove(path)
+		switch {
+		case err == nil:
+			stats.IncrementDeleted()
+			reporter.FileDeleted(path)
+			logger.Audit("deleted", "path", path)
+			deletedCount++
+		case !os.IsNotExist(err):
+			stats.IncrementErrors()
+			logger.Error("removing obsolete file failed", err, "path", path)
+			continue
+		}
+		state.ForgetFile(device, path)
+	}
+
 	if deletedCount > 0 {
 		fmt.Printf("%s✓ Cleaned up %d obsolete file(s)%s\n", colorYellow, deletedCount, colorReset)
 	}
@@ -296,6 +403,37 @@ func cleanupObsoleteFiles(localDir string, remoteFiles map[string]bool, stats *S
 	return nil
 }
 
+// newQuickClient returns the client for quick operations (HEAD requests,
+// directory listings) with TLS verification disabled (--no-check-certificate).
+func newQuickClient() *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+		Timeout: 30 * time.Second,
+	}
+}
+
+// newDownloadClient returns the client for downloads: connection timeouts but
+// no overall timeout for large files, with TLS verification disabled
+// (--no-check-certificate).
+func newDownloadClient(maxConcurrent int) *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+			DialContext: (&net.Dialer{
+				Timeout:   30 * time.Second,
+				KeepAlive: 30 * time.Second,
+			}).DialContext,
+			TLSHandshakeTimeout: 10 * time.Second,
+			IdleConnTimeout:     90 * time.Second,
+			MaxIdleConns:        100,
+			MaxIdleConnsPerHost: maxConcurrent,
+		},
+		Timeout: 0,
+	}
+}
+
 func getDirectoryListing(client *http.Client, dirURL string, onDir func(string)) ([]FileInfo, error) {
 	return getDirectoryListingRec(client, dirURL, "", onDir)
 }
@@ -318,7 +456,7 @@ func getDirectoryListingRec(client *http.Client, dirURL, subDir string, onDir fu
 		}
 		if resp.StatusCode != http.StatusOK {
 			resp.Body.Close()
-			lastErr = fmt.Errorf("HTTP %d: %s", resp.StatusCode, resp.Status)
+			lastErr = &httpStatusError{Code: resp.StatusCode, Status: resp.Status}
 			if attempt == downloadMaxRetries {
 				return nil, lastErr
 			}
@@ -457,32 +595,56 @@ func parseSizeString(sizeStr string) int64 {
 	return int64(value * float64(multiplier))
 }
 
-func shouldDownload(client *http.Client, remoteURL, localPath string) (bool, error) {
+// shouldDownload reports whether the local copy is missing or differs from
+// the remote file. remoteSize is the exact remote size, or -1 if the remote
+// was not asked because there is no local copy.
+func shouldDownload(client *http.Client, remoteURL, localPath string) (needsDownload bool, remoteSize int64, err error) {
 	// Check if local file exists
 	localInfo, err := os.Stat(localPath)
 	if os.IsNotExist(err) {
-		return true, nil
+		return true, -1, nil
 	}
 	if err != nil {
-		return false, err
+		return false, -1, err
 	}
 
 	// Get remote file info
+	remoteSize, remoteTime, err := headFile(client, remoteURL)
+	if err != nil {
+		return false, -1, err
+	}
+
+	// Compare sizes
+	if remoteSize != localInfo.Size() {
+		return true, remoteSize, nil
+	}
+
+	// Compare modification times if available
+	if !remoteTime.IsZero() && remoteTime.After(localInfo.ModTime()) {
+		return true, remoteSize, nil
+	}
+
+	return false, remoteSize, nil // File is up to date
+}
+
+// headFile returns a remote file's exact size and its Last-Modified time
+// (zero if the server sends none), retrying transient errors.
+func headFile(client *http.Client, remoteURL string) (size int64, modTime time.Time, err error) {
 	var resp *http.Response
 	var lastErr error
 	for attempt := 0; attempt <= downloadMaxRetries; attempt++ {
 		resp, lastErr = client.Head(remoteURL)
 		if lastErr != nil {
 			if attempt == downloadMaxRetries {
-				return false, lastErr
+				return 0, time.Time{}, lastErr
 			}
 			continue
 		}
 		if resp.StatusCode != http.StatusOK {
 			resp.Body.Close()
-			lastErr = fmt.Errorf("HTTP %d: %s", resp.StatusCode, resp.Status)
+			lastErr = &httpStatusError{Code: resp.StatusCode, Status: resp.Status}
 			if attempt == downloadMaxRetries {
-				return false, lastErr
+				return 0, time.Time{}, lastErr
 			}
 			continue
 		}
@@ -490,40 +652,34 @@ func shouldDownload(client *http.Client, remoteURL, localPath string) (bool, err
 	}
 	defer resp.Body.Close()
 
-	// Compare sizes
-	remoteSize := resp.ContentLength
-	localSize := localInfo.Size()
-
-	if remoteSize != localSize {
-		return true, nil
-	}
-
-	// Compare modification times if available
 	if lastModified := resp.Header.Get("Last-Modified"); lastModified != "" {
-		remoteTime, err := http.ParseTime(lastModified)
-		if err == nil {
-			if remoteTime.After(localInfo.ModTime()) {
-				return true, nil
-			}
-		}
+		modTime, _ = http.ParseTime(lastModified)
 	}
-
-	return false, nil // File is up to date
+	return resp.ContentLength, modTime, nil
 }
 
 // downloadFile downloads a file with automatic retry on stall or transient error.
-// It uses HTTP Range requests to resume from where a failed attempt left off.
+// Data is written to filePath+partSuffix and renamed to filePath when complete.
+// It uses HTTP Range requests to resume from where a failed attempt, or a
+// partial file left by an earlier run, left off.
 // Returns total bytes written to the file.
-func downloadFile(client *http.Client, fileURL, filePath string, onProgress func(written, total int64)) (int64, error) {
+func downloadFile(ctx context.Context, client *http.Client, fileURL, filePath string, opts downloadOptions, onProgress func(written, total int64)) (int64, error) {
+	partPath := filePath + partSuffix
 	var totalInFile int64
+	if info, err := os.Stat(partPath); err == nil {
+		totalInFile = info.Size()
+	}
 	for attempt := 0; attempt <= downloadMaxRetries; attempt++ {
-		n, err := downloadAttempt(client, fileURL, filePath, totalInFile, onProgress)
+		n, err := downloadAttempt(ctx, client, fileURL, partPath, totalInFile, opts, onProgress)
 		totalInFile = n
 		if err == nil {
-			return totalInFile, nil
+			return totalInFile, os.Rename(partPath, filePath)
 		}
-		if attempt == downloadMaxRetries {
-			return totalInFile, err
+		if attempt == downloadMaxRetries || ctx.Err() != nil {
+			return totalInFile, err // cancelled downloads are not retried
+		}
+		if opts.onRetry != nil {
+			opts.onRetry(attempt+1, err)
 		}
 	}
 	return totalInFile, nil
@@ -531,24 +687,46 @@ func downloadFile(client *http.Client, fileURL, filePath string, onProgress func
 
 // downloadAttempt performs a single download attempt starting at offset.
 // If the server supports Range requests and offset > 0, it resumes from offset;
-// otherwise it restarts from the beginning.
-// Returns total bytes present in the file after this attempt.
-func downloadAttempt(client *http.Client, fileURL, filePath string, offset int64, onProgress func(written, total int64)) (int64, error) {
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+// otherwise, or if the remote file changed since the partial file was written,
+// it restarts from the beginning.
+// Returns total bytes present in the file after this attempt. If ctx is
+// cancelled, the error is its cause; the partial file is kept for resuming.
+func downloadAttempt(ctx context.Context, client *http.Client, fileURL, filePath string, offset int64, opts downloadOptions, onProgress func(written, total int64)) (int64, error) {
+	// Don't start a request while paused
+	if err := opts.pause.Wait(ctx); err != nil {
+		return offset, context.Cause(ctx)
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fileURL, nil)
 	if err != nil {
 		return offset, err
 	}
+	var partTime time.Time // when the partial file was last written
 	if offset > 0 {
 		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		if info, err := os.Stat(filePath); err == nil {
+			partTime = info.ModTime()
+			req.Header.Set("If-Unmodified-Since", partTime.UTC().Format(http.TimeFormat))
+		}
 	}
 
 	resp, err := client.Do(req)
 	if err != nil {
+		if ctx.Err() != nil {
+			err = context.Cause(ctx)
+		}
 		return offset, err
 	}
+	if offset > 0 && remoteChangedSince(resp, partTime) {
+		// The remote file changed after the partial file was written: its
+		// new tail must not be appended to the old prefix, so start over.
+		resp.Body.Close()
+		os.Remove(filePath)
+		return downloadAttempt(ctx, client, fileURL, filePath, 0, opts, onProgress)
+	}
 	defer resp.Body.Close()
 
 	var (
@@ -571,22 +749,30 @@ func downloadAttempt(client *http.Client, fileURL, filePath string, offset int64
 			return offset, err
 		}
 	case http.StatusOK:
-		// Server does not support Range; restart from the beginning
+		// Server does not support Range, or the file changed; restart from
+		// the beginning, truncating the partial file
 		fileOffset = 0
 		totalSize = resp.ContentLength
 		out, err = os.Create(filePath)
 		if err != nil {
 			return 0, err
 		}
+	case http.StatusRequestedRangeNotSatisfiable:
+		// The partial file is not a prefix of the remote file (it changed,
+		// or the partial file is complete or corrupt); start over.
+		os.Remove(filePath)
+		return 0, &httpStatusError{Code: resp.StatusCode, Status: resp.Status}
 	default:
-		return offset, fmt.Errorf("HTTP %d: %s", resp.StatusCode, resp.Status)
+		return offset, &httpStatusError{Code: resp.StatusCode, Status: resp.Status}
 	}
 	defer out.Close()
 
-	// Stall watchdog: cancel the context if no data arrives for stallTimeout
+	// Stall watchdog: cancel the context if no data arrives for stallTimeout.
+	// Time spent paused or held back by the rate limiter does not count.
 	var (
 		lastReadMu sync.Mutex
 		lastRead   = time.Now()
+		throttled  bool // waiting for the rate limiter
 	)
 	watchdogDone := make(chan struct{})
 	defer close(watchdogDone)
@@ -599,24 +785,27 @@ func downloadAttempt(client *http.Client, fileURL, filePath string, offset int64
 				return
 			case <-ticker.C:
 				lastReadMu.Lock()
-				stalled := time.Since(lastRead) > downloadStallTimeout
+				if opts.pause.Paused() || throttled {
+					lastRead = time.Now()
+				}
+				stalled := time.Since(lastRead) > opts.stallTimeout
 				lastReadMu.Unlock()
 				if stalled {
-					cancel()
+					cancel(fmt.Errorf("%w: no data for %s", errStalled, opts.stallTimeout))
 				}
 			}
 		}
 	}()
 
-	// Read loop with stall tracking and progress reporting
+	// Read loop with stall tracking, bandwidth limiting and progress reporting
 	written := int64(0)
-	buf := make([]byte, 32*1024)
+	buf := make([]byte, downloadBufferSize)
 	for {
+		if err := opts.pause.Wait(ctx); err != nil {
+			return fileOffset + written, context.Cause(ctx)
+		}
 		n, rerr := resp.Body.Read(buf)
 		if n > 0 {
-			lastReadMu.Lock()
-			lastRead = time.Now()
-			lastReadMu.Unlock()
 			if _, werr := out.Write(buf[:n]); werr != nil {
 				return fileOffset + written, werr
 			}
@@ -624,11 +813,26 @@ func downloadAttempt(client *http.Client, fileURL, filePath string, offset int64
 			if onProgress != nil {
 				onProgress(fileOffset+written, totalSize)
 			}
+			lastReadMu.Lock()
+			lastRead = time.Now()
+			throttled = true
+			lastReadMu.Unlock()
+			lerr := opts.limiter.Wait(ctx, n)
+			lastReadMu.Lock()
+			lastRead = time.Now()
+			throttled = false
+			lastReadMu.Unlock()
+			if lerr != nil {
+				return fileOffset + written, lerr
+			}
 		}
 		if rerr == io.EOF {
 			break
 		}
 		if rerr != nil {
+			if ctx.Err() != nil {
+				rerr = context.Cause(ctx)
+			}
 			return fileOffset + written, rerr
 		}
 	}
@@ -643,6 +847,21 @@ func downloadAttempt(client *http.Client, fileURL, filePath string, offset int64
 	return fileOffset + written, nil
 }
 
+// remoteChangedSince reports whether resp, the reply to a resumed download,
+// shows that the remote file was modified after partTime: the server refused
+// the If-Unmodified-Since precondition, or ignored it and sent a later
+// Last-Modified. Last-Modified has whole seconds, so partTime is truncated.
+func remoteChangedSince(resp *http.Response, partTime time.Time) bool {
+	if resp.StatusCode == http.StatusPreconditionFailed {
+		return true
+	}
+	if resp.StatusCode != http.StatusPartialContent || partTime.IsZero() {
+		return false
+	}
+	modTime, err := http.ParseTime(resp.Header.Get("Last-Modified"))
+	return err == nil && modTime.After(partTime.Truncate(time.Second))
+}
+
 // parseTotalFromContentRange extracts the total file size from a Content-Range header.
 // Format: "bytes X-Y/Z" → returns Z.
 func parseTotalFromContentRange(contentRange string) int64 {
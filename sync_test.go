@@ -0,0 +1,37 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRemoteChangedSince(t *testing.T) {
+	partTime := time.Date(2026, 10, 1, 12, 0, 0, 500_000_000, time.UTC)
+	response := func(status int, lastModified time.Time) *http.Response {
+		resp := &http.Response{StatusCode: status, Header: make(http.Header)}
+		if !lastModified.IsZero() {
+			resp.Header.Set("Last-Modified", lastModified.Format(http.TimeFormat))
+		}
+		return resp
+	}
+	tests := []struct {
+		name     string
+		resp     *http.Response
+		partTime time.Time
+		want     bool
+	}{
+		{"precondition failed", response(http.StatusPreconditionFailed, time.Time{}), partTime, true},
+		{"modified later", response(http.StatusPartialContent, partTime.Add(time.Hour)), partTime, true},
+		{"modified earlier", response(http.StatusPartialContent, partTime.Add(-time.Hour)), partTime, false},
+		{"same second", response(http.StatusPartialContent, partTime.Truncate(time.Second)), partTime, false},
+		{"no Last-Modified", response(http.StatusPartialContent, time.Time{}), partTime, false},
+		{"full response", response(http.StatusOK, partTime.Add(time.Hour)), partTime, false},
+		{"unknown part time", response(http.StatusPartialContent, partTime.Add(time.Hour)), time.Time{}, false},
+	}
+	for _, tt := range tests {
+		if got := remoteChangedSince(tt.resp, tt.partTime); got != tt.want {
+			t.Errorf("%s: remoteChangedSince = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
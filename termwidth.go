@@ -3,6 +3,8 @@
 package main
 
 import (
+	"os"
+	"os/signal"
 	"syscall"
 	"unsafe"
 )
@@ -26,3 +28,49 @@ func terminalWidth() int {
 	}
 	return 80
 }
+
+// terminalHeight returns the current terminal height in rows, or 24 if unknown.
+func terminalHeight() int {
+	var ws winsize
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL,
+		uintptr(syscall.Stdout),
+		syscall.TIOCGWINSZ,
+		uintptr(unsafe.Pointer(&ws))); errno == 0 && ws.Row > 0 {
+		return int(ws.Row)
+	}
+	return 24
+}
+
+// stdoutIsTerminal reports whether stdout is a terminal rather than a pipe
+// or file.
+func stdoutIsTerminal() bool {
+	var termios syscall.Termios
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL,
+		uintptr(syscall.Stdout),
+		ioctlGetTermios,
+		uintptr(unsafe.Pointer(&termios)))
+	return errno == 0
+}
+
+// watchResize returns a channel that receives when the terminal is resized
+// (SIGWINCH), until done is closed.
+func watchResize(done <-chan struct{}) <-chan struct{} {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGWINCH)
+	resized := make(chan struct{}, 1)
+	go func() {
+		defer signal.Stop(signals)
+		for {
+			select {
+			case <-signals:
+				select {
+				case resized <- struct{}{}:
+				default:
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return resized
+}
@@ -7,3 +7,21 @@ package main
 func terminalWidth() int {
 	return 80
 }
+
+// terminalHeight returns a conservative default on platforms where we don't
+// query the terminal size.
+func terminalHeight() int {
+	return 24
+}
+
+// stdoutIsTerminal assumes a terminal on platforms where we can't tell;
+// -plain or NO_COLOR switch to plain output.
+func stdoutIsTerminal() bool {
+	return true
+}
+
+// watchResize never fires on platforms where we don't query the terminal
+// size; callers that redraw periodically would not see a new size anyway.
+func watchResize(<-chan struct{}) <-chan struct{} {
+	return nil
+}
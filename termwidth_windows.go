@@ -38,3 +38,40 @@ func terminalWidth() int {
 	}
 	return w
 }
+
+// terminalHeight returns the current console window height in rows, or 24
+// if the query fails (e.g. stdout is redirected).
+func terminalHeight() int {
+	hStdout, _, _ := procGetStdHandle.Call(stdOutputHandle)
+	if hStdout == 0 || hStdout == ^uintptr(0) {
+		return 24
+	}
+	var info consoleScreenBufferInfo
+	ret, _, _ := procGetConsoleScreenBufferInfo.Call(hStdout, uintptr(unsafe.Pointer(&info)))
+	if ret == 0 {
+		return 24
+	}
+	h := int(info.Window.Bottom-info.Window.Top) + 1
+	if h <= 0 {
+		return 24
+	}
+	return h
+}
+
+// stdoutIsTerminal reports whether stdout is a console rather than a pipe
+// or file.
+func stdoutIsTerminal() bool {
+	hStdout, _, _ := procGetStdHandle.Call(stdOutputHandle)
+	if hStdout == 0 || hStdout == ^uintptr(0) {
+		return false
+	}
+	var mode uint32
+	ret, _, _ := procGetConsoleMode.Call(hStdout, uintptr(unsafe.Pointer(&mode)))
+	return ret != 0
+}
+
+// watchResize never fires on Windows, which has no SIGWINCH; callers that
+// redraw periodically pick up a new size on their next redraw.
+func watchResize(<-chan struct{}) <-chan struct{} {
+	return nil
+}
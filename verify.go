@@ -0,0 +1,347 @@
+package main
+
+import (
+	"archive/zip"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// verifyStatus is the outcome of checking one local file.
+type verifyStatus int
+
+const (
+	verifyOK        verifyStatus = iota
+	verifyCorrupt                // fails a zip, hash or DAT check
+	verifyTruncated              // smaller than the recorded remote size
+	verifyUnknown                // not recorded in sync state and not in the DAT
+	verifyCount
+)
+
+var verifyLabels = [verifyCount]string{
+	verifyOK:        "OK",
+	verifyCorrupt:   "Corrupt",
+	verifyTruncated: "Truncated",
+	verifyUnknown:   "Unknown",
+}
+
+// color returns the color a verify status is shown in, looked up when
+// printing so that plain output has none.
+func (s verifyStatus) color() string {
+	switch s {
+	case verifyOK:
+		return colorGreen
+	case verifyCorrupt:
+		return colorRed
+	case verifyTruncated:
+		return colorYellow
+	}
+	return colorDim
+}
+
+// sidecarHashes maps hash sidecar extensions to their hash functions.
+var sidecarHashes = map[string]func() hash.Hash{
+	".md5":    md5.New,
+	".sha1":   sha1.New,
+	".sha256": sha256.New,
+}
+
+// verifyResult is the outcome for one file, with a reason when not OK.
+type verifyResult struct {
+	Path   string
+	Status verifyStatus
+	Detail string
+}
+
+// runVerifyCommand implements `myrientor verify [device…]`: an offline
+// integrity check of every local file.
+func runVerifyCommand(args []string) int {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	flags := registerFlags(fs)
+	datPath := fs.String("dat", "", "Logiqx XML DAT file to check ROM sizes and CRCs against")
+	requeue := fs.Bool("requeue", false, "Queue corrupt and truncated files for re-download on the next sync")
+	fs.Parse(args)
+
+	cfg, err := loadConfig(flags)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s✗ Config error: %v%s\n", colorRed, err, colorReset)
+		return exitConfig
+	}
+	state, err := loadSyncState()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s✗ Error reading state file %s: %v%s\n", colorRed, stateFile, err, colorReset)
+		return exitConfig
+	}
+	devices, err := cfg.MatchDevices(fs.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s✗ %v%s\n", colorRed, err, colorReset)
+		return exitConfig
+	}
+
+	var dat datIndex
+	if *datPath != "" {
+		if dat, err = loadDAT(*datPath); err != nil {
+			fmt.Fprintf(os.Stderr, "%s✗ Error reading DAT %s: %v%s\n", colorRed, *datPath, err, colorReset)
+			return exitConfig
+		}
+	}
+
+	var totals [verifyCount]int
+	requeued := 0
+	for i, device := range devices {
+		fmt.Printf("\n%s\n", devicePanel(i+1, len(devices), "Verifying", device.RemotePath))
+
+		settings, err := cfg.DeviceSettings(device)
+		if err != nil {
+			fmt.Printf("%s✗ Invalid settings: %v%s\n", colorRed, err, colorReset)
+			continue
+		}
+
+		results := verifyDevice(device, settings, state, dat)
+		var counts [verifyCount]int
+		for _, result := range results {
+			counts[result.Status]++
+			totals[result.Status]++
+			if result.Status == verifyOK || result.Status == verifyUnknown {
+				continue
+			}
+			fmt.Printf("  %s✗ %-9s%s %s %s(%s)%s\n", result.Status.color(), verifyLabels[result.Status], colorReset, result.Path, colorDim, result.Detail, colorReset)
+			if *requeue {
+				state.Requeue(device, result.Path)
+				requeued++
+			}
+		}
+		fmt.Printf("  %s%d OK%s  %s%d corrupt%s  %s%d truncated%s  %d unknown\n",
+			colorGreen, counts[verifyOK], colorReset,
+			colorRed, counts[verifyCorrupt], colorReset,
+			colorYellow, counts[verifyTruncated], colorReset,
+			counts[verifyUnknown])
+	}
+
+	if requeued > 0 {
+		if err := state.Save(); err != nil {
+			fmt.Fprintf(os.Stderr, "%s✗ Error saving %s: %v%s\n", colorRed, stateFile, err, colorReset)
+			return exitErrors
+		}
+	}
+
+	fmt.Println()
+	fmt.Println(panelTopLabeled("VERIFY"))
+	fmt.Println(panelLine(fmt.Sprintf("%sFiles:%s    %s%d OK%s  %s%d corrupt%s  %s%d truncated%s  %d unknown",
+		colorBold, colorReset,
+		colorGreen, totals[verifyOK], colorReset,
+		colorRed, totals[verifyCorrupt], colorReset,
+		colorYellow, totals[verifyTruncated], colorReset,
+		totals[verifyUnknown])))
+	if *requeue {
+		fmt.Println(panelLine(fmt.Sprintf("%sRequeued:%s %d file(s) for the next sync", colorBold, colorReset, requeued)))
+	}
+	fmt.Println(panelBottom())
+
+	if totals[verifyCorrupt]+totals[verifyTruncated] > 0 {
+		return exitErrors
+	}
+	return exitOK
+}
+
+// verifyDevice checks every local file of a device concurrently. The
+// progress line is written under a lock, one worker at a time.
+func verifyDevice(device Device, settings SyncSettings, state *SyncState, dat datIndex) []verifyResult {
+	paths := deviceLocalFiles(device, settings, state)
+
+	results := make([]verifyResult, len(paths))
+	sem := make(chan struct{}, settings.MaxConcurrent)
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		done int
+	)
+	for i, path := range paths {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			recorded, ok := state.File(path)
+			var recordedPtr *FileState
+			if ok {
+				recordedPtr = &recorded
+			}
+			status, detail := verifyFile(path, recordedPtr, dat)
+			results[i] = verifyResult{Path: path, Status: status, Detail: detail}
+
+			mu.Lock()
+			defer mu.Unlock()
+			done++
+			prefix := fmt.Sprintf("  Verifying %d/%d: ", done, len(paths))
+			statusLine("%s%s%s%s", colorDim, prefix, fitInTerminal(filepath.Base(path), len(prefix)+1), colorReset)
+		}()
+	}
+	wg.Wait()
+	clearStatusLine()
+	return results
+}
+
+// deviceLocalFiles returns a device's local files, sorted: everything in an
+// exclusive root, or the owned files in a shared one. Hash sidecars, the
+// never-synced systeminfo.txt and partial downloads are not included.
+func deviceLocalFiles(device Device, settings SyncSettings, state *SyncState) []string {
+	var paths []string
+	root, exclusive := layoutRoot(settings.Layout, device)
+	if exclusive {
+		filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() {
+				return nil
+			}
+			if _, isSidecar := sidecarHashes[strings.ToLower(filepath.Ext(path))]; isSidecar || info.Name() == "systeminfo.txt" || strings.HasSuffix(path, partSuffix) {
+				return nil
+			}
+			paths = append(paths, path)
+			return nil
+		})
+	} else {
+		for _, path := range state.OwnedFiles(device) {
+			if _, err := os.Stat(path); err == nil {
+				paths = append(paths, path)
+			}
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// verifyFile checks one file: size against the recorded remote size, zip
+// central directory and per-entry CRCs, hash sidecars, and DAT entries.
+// recorded is nil if the file is not in the sync state.
+func verifyFile(path string, recorded *FileState, dat datIndex) (verifyStatus, string) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return verifyCorrupt, err.Error()
+	}
+	if recorded != nil && recorded.Size > 0 {
+		if info.Size() < recorded.Size {
+			return verifyTruncated, fmt.Sprintf("%s of %s", formatBytes(info.Size()), formatBytes(recorded.Size))
+		}
+		if info.Size() != recorded.Size {
+			return verifyCorrupt, fmt.Sprintf("size %s, expected %s", formatBytes(info.Size()), formatBytes(recorded.Size))
+		}
+	}
+
+	inDAT := false
+	if strings.EqualFold(filepath.Ext(path), ".zip") {
+		entries, err := verifyZip(path)
+		if err != nil {
+			return verifyCorrupt, err.Error()
+		}
+		for _, entry := range entries {
+			if dat == nil {
+				continue
+			}
+			_, matched, known := dat.Match(entry.Name, int64(entry.UncompressedSize64), fmt.Sprintf("%08x", entry.CRC32))
+			if known && !matched {
+				return verifyCorrupt, fmt.Sprintf("%s does not match DAT", entry.Name)
+			}
+			inDAT = inDAT || matched
+		}
+	}
+
+	if status, detail, checked := verifySidecars(path); checked && status != verifyOK {
+		return status, detail
+	}
+
+	if dat != nil && !inDAT {
+		crc, err := fileCRC32(path)
+		if err != nil {
+			return verifyCorrupt, err.Error()
+		}
+		_, matched, known := dat.Match(filepath.Base(path), info.Size(), crc)
+		if known && !matched {
+			return verifyCorrupt, "does not match DAT"
+		}
+		inDAT = matched
+	}
+
+	if recorded == nil && !inDAT {
+		return verifyUnknown, "not recorded in sync state"
+	}
+	return verifyOK, ""
+}
+
+// verifyZip reads every entry of a zip archive; archive/zip checks each
+// entry's CRC32 when its data has been read to the end.
+func verifyZip(path string) ([]*zip.File, error) {
+	reader, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	for _, entry := range reader.File {
+		rc, err := entry.Open()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", entry.Name, err)
+		}
+		_, err = io.Copy(io.Discard, rc)
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", entry.Name, err)
+		}
+	}
+	return reader.File, nil
+}
+
+// verifySidecars checks path against any <path>.md5/.sha1/.sha256 files
+// next to it. checked is false if there are none.
+func verifySidecars(path string) (status verifyStatus, detail string, checked bool) {
+	for ext, newHash := range sidecarHashes {
+		data, err := os.ReadFile(path + ext)
+		if err != nil {
+			continue
+		}
+		fields := strings.Fields(string(data))
+		if len(fields) == 0 {
+			continue
+		}
+		checked = true
+
+		file, err := os.Open(path)
+		if err != nil {
+			return verifyCorrupt, err.Error(), true
+		}
+		h := newHash()
+		_, err = io.Copy(h, file)
+		file.Close()
+		if err != nil {
+			return verifyCorrupt, err.Error(), true
+		}
+		if !strings.EqualFold(hex.EncodeToString(h.Sum(nil)), fields[0]) {
+			return verifyCorrupt, strings.TrimPrefix(ext, ".") + " mismatch", true
+		}
+	}
+	return verifyOK, "", checked
+}
+
+// fileCRC32 returns the CRC32 of a whole file as 8 lower-case hex digits.
+func fileCRC32(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	h := crc32.NewIEEE()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%08x", h.Sum32()), nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVerifyFile(t *testing.T) {
+	dir := t.TempDir()
+	rom := []byte("NES\x1a rom data")
+	romCRC := fmt.Sprintf("%08x", crc32.ChecksumIEEE(rom))
+
+	write := func(name string, data []byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	zipped := func(name string, data []byte) []byte {
+		var buf bytes.Buffer
+		w := zip.NewWriter(&buf)
+		f, _ := w.Create(name)
+		f.Write(data)
+		w.Close()
+		return buf.Bytes()
+	}
+
+	goodZip := zipped("Tetris.nes", rom)
+	badZip := bytes.Clone(goodZip)
+	// Flip a byte of the stored entry data so its CRC no longer matches.
+	badZip[bytes.Index(badZip, rom)] ^= 0xff
+	sum := md5.Sum(rom)
+
+	write("Tetris.zip", goodZip)
+	write("Broken.zip", badZip)
+	write("Truncated.zip", goodZip[:10])
+	write("Hashed.nes", rom)
+	write("Hashed.nes.md5", []byte(hex.EncodeToString(sum[:])+"  Hashed.nes\n"))
+	write("Mismatch.nes", rom)
+	write("Mismatch.nes.md5", []byte("00000000000000000000000000000000\n"))
+	write("Tetris.nes", rom)
+	write("Other.nes", []byte("different"))
+
+	dat := datIndex{
+		"tetris.nes": {{Name: "Tetris.nes", Size: int64(len(rom)), CRC: romCRC}},
+		"other.nes":  {{Name: "Other.nes", Size: int64(len(rom)), CRC: romCRC}},
+	}
+	recorded := func(size int) *FileState { return &FileState{Size: int64(size)} }
+
+	tests := []struct {
+		name     string
+		recorded *FileState
+		dat      datIndex
+		want     verifyStatus
+	}{
+		{"Tetris.zip", recorded(len(goodZip)), nil, verifyOK},
+		{"Tetris.zip", nil, nil, verifyUnknown},
+		{"Tetris.zip", nil, dat, verifyOK},
+		{"Broken.zip", recorded(len(badZip)), nil, verifyCorrupt},
+		{"Truncated.zip", recorded(len(goodZip)), nil, verifyTruncated},
+		{"Tetris.zip", recorded(len(goodZip) - 1), nil, verifyCorrupt},
+		{"Hashed.nes", recorded(len(rom)), nil, verifyOK},
+		{"Mismatch.nes", recorded(len(rom)), nil, verifyCorrupt},
+		{"Tetris.nes", nil, dat, verifyOK},
+		{"Other.nes", nil, dat, verifyCorrupt},
+		{"Missing.nes", nil, nil, verifyCorrupt},
+	}
+	for _, tt := range tests {
+		got, detail := verifyFile(filepath.Join(dir, tt.name), tt.recorded, tt.dat)
+		if got != tt.want {
+			t.Errorf("verifyFile(%s, recorded %v, dat %v) = %s (%s), want %s",
+				tt.name, tt.recorded != nil, tt.dat != nil, verifyLabels[got], detail, verifyLabels[tt.want])
+		}
+	}
+}